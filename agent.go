@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+
+	floatingipk8scli "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned"
+	"github.com/apricote/hcloud-floating-ip-operator/config"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/agent"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
+)
+
+// AgentMain is the main program of the node agent.
+type AgentMain struct {
+	flags  *config.AgentFlags
+	logger log.Logger
+}
+
+// NewAgentMain returns the main application of the node agent.
+func NewAgentMain(logger log.Logger, args []string) *AgentMain {
+	return &AgentMain{
+		flags:  config.NewAgentFlags(args),
+		logger: logger,
+	}
+}
+
+// Run runs the agent.
+func (m *AgentMain) Run(stopC <-chan struct{}) error {
+	m.logger.Infof("initializing hcloud floating ip agent")
+
+	if m.flags.NodeName == "" {
+		return fmt.Errorf("the node name is required, set it with --node-name or NODE_NAME")
+	}
+
+	cfg, err := getRestConfig(m.flags.Development, m.flags.KubeConfig)
+	if err != nil {
+		return err
+	}
+
+	k8sCli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	fipCli, err := floatingipk8scli.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	a := agent.NewAgent(m.flags.AgentConfig(), k8sCli, fipCli, agent.NewNetlink(m.flags.Interface), agent.NewAnnouncer(m.flags.Interface), m.logger)
+	return a.Run(stopC)
+}
@@ -2,4 +2,13 @@ package hcloud
 
 const (
 	GroupName = "hcloud.apricote.de"
+
+	// ConfiguredFloatingIPsAnnotation is the node annotation the agent
+	// reports the floating ips configured on the node with.
+	ConfiguredFloatingIPsAnnotation = GroupName + "/configured-floating-ips"
+
+	// ManagedAddressesAnnotation is the node annotation the agent tracks the
+	// addresses it added to the interface with, so they are removed once
+	// their floating ip is gone.
+	ManagedAddressesAnnotation = GroupName + "/managed-addresses"
 )
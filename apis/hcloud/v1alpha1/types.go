@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -14,19 +15,426 @@ type FloatingIP struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec FloatinIPSpec `json:"spec"`
+	// +optional
+	Status FloatingIPStatus `json:"status,omitempty"`
 }
 
 // FloatinIPSpec defines a floating ip resource
 type FloatinIPSpec struct {
 	// Floating IP from Hetzner that will be assigned to nodes matching the
-	// nodeSelector
-	IP string `json:"IP"`
+	// nodeSelector. IPv6 floating ips can be given as any address or prefix
+	// of their /64 network. Only one of IP, id, name and selector can be
+	// set, if none is set a new floating ip of the type in the home
+	// location is created.
+	// +optional
+	IP string `json:"IP,omitempty"`
+
+	// Floating IPs from Hetzner that are managed as a pool, the entries are
+	// matched like IP. Cannot be combined with IP, id, name and selector.
+	// +optional
+	IPs []string `json:"ips,omitempty"`
+
+	// How the floating ips of the pool are distributed over the nodes,
+	// defaults to Colocate
+	// +optional
+	Distribution DistributionPolicy `json:"distribution,omitempty"`
+
+	// ID of the floating ip in Hetzner
+	// +optional
+	ID int `json:"id,omitempty"`
+
+	// Name of the floating ip in Hetzner, matched against its description
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Selector on the labels of floating ips in Hetzner, all matching
+	// floating ips are managed as a pool like the ips.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Type of the floating ip that is created if no reference is set
+	// +optional
+	Type FloatingIPType `json:"type,omitempty"`
+
+	// Name of the location the floating ip is created in if no IP is set
+	// +optional
+	HomeLocation string `json:"homeLocation,omitempty"`
+
+	// What happens to the floating ip in Hetzner when the resource is
+	// deleted, defaults to Retain
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
 
 	// Query to select a pool of nodes that
 	NodeSelector map[string]string `json:"nodeSelector"`
 
+	// Query to select pods, only nodes running a ready pod matching the
+	// selector are targets of the floating ip
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+
+	// Namespace of the pods selected by the podSelector, pods of all
+	// namespaces are selected if empty
+	// +optional
+	PodNamespace string `json:"podNamespace,omitempty"`
+
 	// Frequency for reconcilation loops
 	IntervalSeconds Seconds `json:"intervalSeconds,omitempty"`
+
+	// Conditions and taints that disqualify a node as a target. Nodes that
+	// are not Ready are never considered.
+	// +optional
+	NodeHealth *NodeHealth `json:"nodeHealth,omitempty"`
+
+	// Health check of the service behind the floating ip, only nodes
+	// passing it are targets
+	// +optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// Limits how often the floating ip is moved between nodes
+	// +optional
+	Hysteresis *Hysteresis `json:"hysteresis,omitempty"`
+
+	// Strategy to select the node the floating ip gets assigned to,
+	// defaults to random
+	// +optional
+	Strategy SelectionStrategy `json:"strategy,omitempty"`
+
+	// Nodes the floating ip should live on, ordered by weight and then by
+	// their position in the list. Setting them makes preferred-node-order
+	// the default strategy.
+	// +optional
+	PreferredNodes []PreferredNode `json:"preferredNodes,omitempty"`
+
+	// When the floating ip returns to a more preferred node that became
+	// available again, defaults to Never
+	// +optional
+	Failback FailbackPolicy `json:"failback,omitempty"`
+
+	// Time a more preferred node has to be available before the floating
+	// ip returns to it with the AfterDelay failback policy
+	// +optional
+	FailbackDelaySeconds Seconds `json:"failbackDelaySeconds,omitempty"`
+}
+
+// PreferredNode is a node the floating ip should live on
+type PreferredNode struct {
+	Name string `json:"name"`
+
+	// Nodes with a higher weight are preferred, nodes with the same weight
+	// keep the order of the list
+	// +optional
+	Weight int `json:"weight,omitempty"`
+}
+
+// FailbackPolicy defines when a floating ip returns to a more preferred
+// node
+type FailbackPolicy string
+
+// Available failback policies
+const (
+	// FailbackNever leaves the floating ip on its node as long as it is a
+	// probable target
+	FailbackNever FailbackPolicy = "Never"
+	// FailbackImmediate moves the floating ip as soon as a more preferred
+	// node is available
+	FailbackImmediate FailbackPolicy = "Immediate"
+	// FailbackAfterDelay moves the floating ip once a more preferred node
+	// was available for the failback delay
+	FailbackAfterDelay FailbackPolicy = "AfterDelay"
+)
+
+// FloatingIPType is the ip version of a floating ip
+type FloatingIPType string
+
+// Available floating ip types
+const (
+	FloatingIPTypeIPv4 FloatingIPType = "ipv4"
+	FloatingIPTypeIPv6 FloatingIPType = "ipv6"
+)
+
+// DeletionPolicy defines what happens to the floating ip in Hetzner when
+// the resource is deleted
+type DeletionPolicy string
+
+// Available deletion policies
+const (
+	// DeletionPolicyRetain leaves the floating ip assigned
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyUnassign unassigns the floating ip
+	DeletionPolicyUnassign DeletionPolicy = "Unassign"
+	// DeletionPolicyDelete deletes the floating ip from Hetzner if it was
+	// created by the operator, other floating ips are unassigned
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
+
+// DistributionPolicy defines how the floating ips of a pool are distributed
+// over the nodes
+type DistributionPolicy string
+
+// Available distribution policies
+const (
+	// DistributionColocate assigns all floating ips to the same node
+	DistributionColocate DistributionPolicy = "Colocate"
+	// DistributionSpread assigns the floating ips to as many nodes as
+	// possible
+	DistributionSpread DistributionPolicy = "Spread"
+)
+
+// SelectionStrategy is the name of a node selection strategy
+type SelectionStrategy string
+
+// Available node selection strategies
+const (
+	// StrategyRandom selects a random node
+	StrategyRandom SelectionStrategy = "random"
+	// StrategyFirstByName selects the first node ordered by name
+	StrategyFirstByName SelectionStrategy = "first-by-name"
+	// StrategyLeastLoaded selects the node with the fewest floating ips
+	StrategyLeastLoaded SelectionStrategy = "least-loaded"
+	// StrategySpread selects the node with the fewest floating ips that
+	// use the same node selector
+	StrategySpread SelectionStrategy = "spread"
+	// StrategyPreferredNodeOrder selects the most preferred available node
+	// of the preferred nodes
+	StrategyPreferredNodeOrder SelectionStrategy = "preferred-node-order"
+)
+
+// NodeHealth defines which nodes are considered unhealthy
+type NodeHealth struct {
+	// Node conditions that disqualify a node if their status is True.
+	// Defaults to MemoryPressure, DiskPressure and NetworkUnavailable.
+	// +optional
+	ExcludeConditions []corev1.NodeConditionType `json:"excludeConditions,omitempty"`
+
+	// Taints that disqualify a node. Defaults to all taints with the
+	// NoExecute effect.
+	// +optional
+	ExcludeTaints []TaintSelector `json:"excludeTaints,omitempty"`
+
+	// Allow nodes that are cordoned (spec.unschedulable) as targets
+	// +optional
+	AllowUnschedulable bool `json:"allowUnschedulable,omitempty"`
+}
+
+// TaintSelector matches taints of a node. Empty fields match any value.
+type TaintSelector struct {
+	Key    string             `json:"key,omitempty"`
+	Effect corev1.TaintEffect `json:"effect,omitempty"`
+}
+
+// HealthCheck probes the service behind the floating ip on the internal
+// address of every probable node. Exactly one of tcp, http and exec has to
+// be set.
+type HealthCheck struct {
+	// Connect to a tcp port
+	// +optional
+	TCP *TCPHealthCheck `json:"tcp,omitempty"`
+
+	// Send a http get request
+	// +optional
+	HTTP *HTTPHealthCheck `json:"http,omitempty"`
+
+	// Run a command in a pod on the node
+	// +optional
+	Exec *ExecHealthCheck `json:"exec,omitempty"`
+
+	// Time after which a tcp or http probe fails, defaults to 1
+	// +optional
+	TimeoutSeconds Seconds `json:"timeoutSeconds,omitempty"`
+
+	// Consecutive failed probes after which a healthy node is unhealthy,
+	// defaults to 3
+	// +optional
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// Consecutive successful probes after which an unhealthy node is
+	// healthy, defaults to 1
+	// +optional
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+}
+
+// TCPHealthCheck succeeds if a connection to the port can be opened
+type TCPHealthCheck struct {
+	Port int32 `json:"port"`
+}
+
+// HTTPHealthCheck succeeds if a get request returns the expected status
+type HTTPHealthCheck struct {
+	Port int32 `json:"port"`
+
+	// Path of the request, defaults to /
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Scheme of the request, HTTP or HTTPS, defaults to HTTP. Certificates
+	// are not verified.
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+
+	// Status code the response must have, defaults to 200
+	// +optional
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+}
+
+// ExecHealthCheck succeeds if the command exits with 0. The command runs in
+// a pod in the host network of the node, the internal address of the node
+// is available as NODE_ADDRESS. The pods run in the namespace of the
+// operator. The result of a probe is only available at the next reconcile.
+type ExecHealthCheck struct {
+	Image   string   `json:"image"`
+	Command []string `json:"command"`
+
+	// Time a pod may take to be scheduled, pull its image and run the
+	// command before the probe fails, defaults to 60
+	// +optional
+	DeadlineSeconds Seconds `json:"deadlineSeconds,omitempty"`
+
+	// Minimal time between the start of two pods on a node, defaults to 30
+	// +optional
+	PeriodSeconds Seconds `json:"periodSeconds,omitempty"`
+}
+
+// Hysteresis limits how often a floating ip is moved between nodes. A
+// move is critical if the node the floating ip is on is NotReady or gone,
+// all other moves, like a failing health check or pod selector, are non
+// critical. A move is optional if the floating ip is on a valid target,
+// like failing back or rebalancing a pool. The moves of every floating ip
+// of a pool are counted on their own.
+type Hysteresis struct {
+	// Time a floating ip stays on a node before it is moved for non
+	// critical reasons
+	// +optional
+	MinDwellSeconds Seconds `json:"minDwellSeconds,omitempty"`
+
+	// Time after a move in which the floating ip is not moved again, not
+	// even for critical reasons
+	// +optional
+	CooldownSeconds Seconds `json:"cooldownSeconds,omitempty"`
+
+	// Number of moves within the window after which optional moves are
+	// paused until older moves leave the window, unlimited if not set
+	// +optional
+	MaxMoves int `json:"maxMoves,omitempty"`
+
+	// Window the moves are counted in, defaults to 3600
+	// +optional
+	WindowSeconds Seconds `json:"windowSeconds,omitempty"`
+}
+
+// FloatingIPStatus is the observed assignment of a floating ip
+type FloatingIPStatus struct {
+	// Name of the node the floating ip is currently assigned to
+	NodeName string `json:"nodeName,omitempty"`
+
+	// ID of the hcloud server the floating ip is currently assigned to
+	ServerID int `json:"serverID,omitempty"`
+
+	// ID of the hcloud floating ip resource
+	FloatingIPID int `json:"floatingIPID,omitempty"`
+
+	// Address of the hcloud floating ip resource, the /64 network for ipv6
+	IP string `json:"IP,omitempty"`
+
+	// Address family of the hcloud floating ip resource
+	Family FloatingIPType `json:"family,omitempty"`
+
+	// Last time the floating ip was moved to another node
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// ID of the last hcloud action assigning the floating ip
+	ActionID int `json:"actionID,omitempty"`
+
+	// Last time the assignment was verified without errors
+	LastReconcileTime metav1.Time `json:"lastReconcileTime,omitempty"`
+
+	// Current conditions of the floating ip
+	Conditions []FloatingIPCondition `json:"conditions,omitempty"`
+
+	// Whether the last reconcile failed with a transient or a permanent
+	// error, empty if it succeeded
+	FailureClass FailureClass `json:"failureClass,omitempty"`
+
+	// Number of reconciles that failed in a row
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+
+	// Assignments of the floating ips of a pool
+	IPs []FloatingIPAssignment `json:"ips,omitempty"`
+
+	// Times of the moves within the window of the hysteresis
+	RecentMoves []metav1.Time `json:"recentMoves,omitempty"`
+}
+
+// FloatingIPAssignment is the observed assignment of one floating ip of a
+// pool
+type FloatingIPAssignment struct {
+	// Floating IP of the pool as given in the spec
+	Reference string `json:"reference"`
+
+	// ID of the hcloud floating ip resource
+	FloatingIPID int `json:"floatingIPID,omitempty"`
+
+	// Address of the hcloud floating ip resource, the /64 network for ipv6
+	IP string `json:"IP,omitempty"`
+
+	// Address family of the hcloud floating ip resource
+	Family FloatingIPType `json:"family,omitempty"`
+
+	// Name of the node the floating ip is currently assigned to
+	NodeName string `json:"nodeName,omitempty"`
+
+	// ID of the hcloud server the floating ip is currently assigned to
+	ServerID int `json:"serverID,omitempty"`
+
+	// Last time the floating ip was moved to another node
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// ID of the last hcloud action assigning the floating ip
+	ActionID int `json:"actionID,omitempty"`
+
+	// Times of the moves of the floating ip within the window of the
+	// hysteresis
+	RecentMoves []metav1.Time `json:"recentMoves,omitempty"`
+}
+
+// FailureClass tells if a failed reconcile is retried
+type FailureClass string
+
+// Available failure classes
+const (
+	// FailureTransient errors are retried, api failures with an exponential
+	// backoff
+	FailureTransient FailureClass = "Transient"
+	// FailurePermanent errors are not retried until the spec changes
+	FailurePermanent FailureClass = "Permanent"
+)
+
+// FloatingIPConditionType is the type of a floating ip condition
+type FloatingIPConditionType string
+
+// FloatingIP condition types
+const (
+	// FloatingIPAssigned means the ip is assigned to a node matching the spec
+	FloatingIPAssigned FloatingIPConditionType = "Assigned"
+	// FloatingIPReady means the last reconcilation succeeded
+	FloatingIPReady FloatingIPConditionType = "Ready"
+	// FloatingIPDegraded means the last reconcilation failed
+	FloatingIPDegraded FloatingIPConditionType = "Degraded"
+)
+
+// FloatingIPCondition describes the state of a floating ip at a certain point
+type FloatingIPCondition struct {
+	Type   FloatingIPConditionType `json:"type"`
+	Status corev1.ConditionStatus  `json:"status"`
+
+	// Last time the condition changed its status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Machine readable reason for the last transition
+	Reason string `json:"reason,omitempty"`
+
+	// Human readable message for the last transition
+	Message string `json:"message,omitempty"`
 }
 
 // Seconds is an duration in seconds
@@ -76,6 +76,17 @@ func (c *FakeFloatingIPs) Update(floatingIP *v1alpha1.FloatingIP) (result *v1alp
 	return obj.(*v1alpha1.FloatingIP), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeFloatingIPs) UpdateStatus(floatingIP *v1alpha1.FloatingIP) (*v1alpha1.FloatingIP, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateSubresourceAction(floatingipsResource, "status", floatingIP), &v1alpha1.FloatingIP{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.FloatingIP), err
+}
+
 // Delete takes name of the floatingIP and deletes it. Returns an error if one occurs.
 func (c *FakeFloatingIPs) Delete(name string, options *v1.DeleteOptions) error {
 	_, err := c.Fake.
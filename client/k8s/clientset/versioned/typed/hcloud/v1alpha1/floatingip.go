@@ -19,6 +19,7 @@ type FloatingIPsGetter interface {
 type FloatingIPInterface interface {
 	Create(*v1alpha1.FloatingIP) (*v1alpha1.FloatingIP, error)
 	Update(*v1alpha1.FloatingIP) (*v1alpha1.FloatingIP, error)
+	UpdateStatus(*v1alpha1.FloatingIP) (*v1alpha1.FloatingIP, error)
 	Delete(name string, options *v1.DeleteOptions) error
 	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
 	Get(name string, options v1.GetOptions) (*v1alpha1.FloatingIP, error)
@@ -95,6 +96,21 @@ func (c *floatingIPs) Update(floatingIP *v1alpha1.FloatingIP) (result *v1alpha1.
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *floatingIPs) UpdateStatus(floatingIP *v1alpha1.FloatingIP) (result *v1alpha1.FloatingIP, err error) {
+	result = &v1alpha1.FloatingIP{}
+	err = c.client.Put().
+		Resource("floatingips").
+		Name(floatingIP.Name).
+		SubResource("status").
+		Body(floatingIP).
+		Do().
+		Into(result)
+	return
+}
+
 // Delete takes name of the floatingIP and deletes it. Returns an error if one occurs.
 func (c *floatingIPs) Delete(name string, options *v1.DeleteOptions) error {
 	return c.client.Delete().
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/client-go/util/homedir"
+
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/agent"
+)
+
+// AgentFlags are the node agent flags.
+type AgentFlags struct {
+	flagSet *flag.FlagSet
+
+	ResyncSec   int
+	KubeConfig  string
+	Development bool
+	NodeName    string
+	Interface   string
+
+	AnnounceCount    int
+	AnnounceInterval time.Duration
+}
+
+// AgentConfig converts the command line flag arguments to agent configuration.
+func (f *AgentFlags) AgentConfig() agent.Config {
+	return agent.Config{
+		NodeName:         f.NodeName,
+		Interface:        f.Interface,
+		ResyncPeriod:     time.Duration(f.ResyncSec) * time.Second,
+		AnnounceCount:    f.AnnounceCount,
+		AnnounceInterval: f.AnnounceInterval,
+	}
+}
+
+// NewAgentFlags returns new AgentFlags parsed from the arguments after the
+// agent subcommand.
+func NewAgentFlags(args []string) *AgentFlags {
+	f := &AgentFlags{
+		flagSet: flag.NewFlagSet(os.Args[0]+" agent", flag.ExitOnError),
+	}
+	// Get the user kubernetes configuration in it's home directory.
+	kubehome := filepath.Join(homedir.HomeDir(), ".kube", "config")
+
+	// Init flags.
+	f.flagSet.IntVar(&f.ResyncSec, "resync-seconds", 30, "The number of seconds the agent will resync the addresses of the interface")
+	f.flagSet.StringVar(&f.KubeConfig, "kubeconfig", kubehome, "kubernetes configuration path, only used when development mode enabled")
+	f.flagSet.BoolVar(&f.Development, "development", false, "development flag will allow to run the agent outside a kubernetes cluster")
+	f.flagSet.StringVar(&f.NodeName, "node-name", "", "name of the node the agent runs on, defaults to the NODE_NAME environment variable")
+	f.flagSet.StringVar(&f.Interface, "interface", "eth0", "interface the floating ips are configured on")
+
+	f.flagSet.IntVar(&f.AnnounceCount, "announce-count", 3, "number of gratuitous arps or unsolicited neighbor advertisements sent after a floating ip moved to the node, 0 disables them")
+	f.flagSet.DurationVar(&f.AnnounceInterval, "announce-interval", time.Second, "time between two announcements of a floating ip")
+
+	f.flagSet.Parse(args)
+
+	if f.NodeName == "" {
+		f.NodeName = os.Getenv("NODE_NAME")
+	}
+
+	return f
+}
@@ -15,16 +15,32 @@ import (
 type Flags struct {
 	flagSet *flag.FlagSet
 
-	ResyncSec   int
-	KubeConfig  string
-	HCloudToken string
-	Development bool
+	ResyncSec      int
+	KubeConfig     string
+	HCloudToken    string
+	Development    bool
+	MetricsAddress string
+	ServerIDKey    string
+	HCloudCacheTTL time.Duration
+	RequireAgent   bool
+	Namespace      string
+
+	LeaderElection              bool
+	LeaderElectionName          string
+	LeaderElectionNamespace     string
+	LeaderElectionLeaseDuration time.Duration
+	LeaderElectionRenewDeadline time.Duration
+	LeaderElectionRetryPeriod   time.Duration
 }
 
 // OperatorConfig converts the command line flag arguments to operator configuration.
 func (f *Flags) OperatorConfig() operator.Config {
 	return operator.Config{
-		ResyncPeriod: time.Duration(f.ResyncSec) * time.Second,
+		ResyncPeriod:   time.Duration(f.ResyncSec) * time.Second,
+		ServerIDKey:    f.ServerIDKey,
+		HCloudCacheTTL: f.HCloudCacheTTL,
+		RequireAgent:   f.RequireAgent,
+		Namespace:      f.Namespace,
 	}
 }
 
@@ -41,12 +57,29 @@ func NewFlags() *Flags {
 	f.flagSet.StringVar(&f.KubeConfig, "kubeconfig", kubehome, "kubernetes configuration path, only used when development mode enabled")
 	f.flagSet.BoolVar(&f.Development, "development", false, "development flag will allow to run the operator outside a kubernetes cluster")
 	f.flagSet.StringVar(&f.HCloudToken, "hcloud-token", "", "api token for the hetzner cloud")
+	f.flagSet.StringVar(&f.MetricsAddress, "metrics-address", "", "address to serve prometheus metrics on (e.g. :9090), metrics are disabled if empty")
+	f.flagSet.StringVar(&f.ServerIDKey, "server-id-key", "hcloud.apricote.de/server-id", "node label or annotation holding the hcloud server id, used for nodes without a hcloud provider id")
+	f.flagSet.DurationVar(&f.HCloudCacheTTL, "hcloud-cache-ttl", 5*time.Second, "duration floating ips and servers read from the hetzner cloud api are shared between all floating ips")
+	f.flagSet.BoolVar(&f.RequireAgent, "require-agent", false, "only assign floating ips to nodes with a node agent and report them as ready once it configured them")
+	f.flagSet.StringVar(&f.Namespace, "namespace", "", "namespace the operator runs in and creates the pods of exec health checks in, defaults to the POD_NAMESPACE environment variable or kube-system")
+	f.flagSet.BoolVar(&f.LeaderElection, "leader-election", false, "only run the operator when it holds the leader election lock, required to run multiple replicas")
+	f.flagSet.StringVar(&f.LeaderElectionName, "leader-election-name", "hcloud-floating-ip-operator", "name of the leader election lock")
+	f.flagSet.StringVar(&f.LeaderElectionNamespace, "leader-election-namespace", "kube-system", "namespace of the leader election lock")
+	f.flagSet.DurationVar(&f.LeaderElectionLeaseDuration, "leader-election-lease-duration", 15*time.Second, "duration followers wait before trying to acquire a lock that was not renewed")
+	f.flagSet.DurationVar(&f.LeaderElectionRenewDeadline, "leader-election-renew-deadline", 10*time.Second, "duration the leader retries renewing the lock before giving up leadership")
+	f.flagSet.DurationVar(&f.LeaderElectionRetryPeriod, "leader-election-retry-period", 2*time.Second, "duration between attempts to acquire or renew the lock")
 
 	f.flagSet.Parse(os.Args[1:])
 
 	if len(os.Getenv("HCLOUD_API_TOKEN")) != 0 {
 		f.HCloudToken = os.Getenv("HCLOUD_API_TOKEN")
 	}
+	if f.Namespace == "" {
+		f.Namespace = os.Getenv("POD_NAMESPACE")
+	}
+	if f.Namespace == "" {
+		f.Namespace = "kube-system"
+	}
 
 	return f
 }
@@ -2,14 +2,18 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/hetznercloud/hcloud-go/hcloud"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spotahome/kooper/client/crd"
 	applogger "github.com/spotahome/kooper/log"
+	"github.com/spotahome/kooper/operator/controller/leaderelection"
 	apiextensionscli "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -17,7 +21,9 @@ import (
 
 	floatingipk8scli "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned"
 	"github.com/apricote/hcloud-floating-ip-operator/config"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
 	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/metrics"
 
 	"github.com/apricote/hcloud-floating-ip-operator/pkg/operator"
 )
@@ -49,34 +55,67 @@ func (m *Main) Run(stopC <-chan struct{}) error {
 		return err
 	}
 
+	metricsRec := m.getMetricsRecorder()
+
 	hcloudCli := hcloud.NewClient(hcloud.WithToken(m.flags.HCloudToken))
+	cloudCli := cloud.NewInstrumented(cloud.NewHCloud(hcloudCli), metricsRec)
 
 	// Create the operator and run
-	op, err := operator.New(m.config, fipCli, crdCli, k8sCli, hcloudCli, m.logger)
+	op, err := operator.New(m.config, fipCli, crdCli, k8sCli, cloudCli, metricsRec, m.logger)
+	if err != nil {
+		return err
+	}
+
+	if !m.flags.LeaderElection {
+		return op.Run(stopC)
+	}
+
+	// Only run the operator while we are the leader.
+	lockCfg := &leaderelection.LockConfig{
+		LeaseDuration: m.flags.LeaderElectionLeaseDuration,
+		RenewDeadline: m.flags.LeaderElectionRenewDeadline,
+		RetryPeriod:   m.flags.LeaderElectionRetryPeriod,
+	}
+	le, err := leaderelection.New(m.flags.LeaderElectionName, m.flags.LeaderElectionNamespace, lockCfg, k8sCli, m.logger)
 	if err != nil {
 		return err
 	}
 
-	return op.Run(stopC)
+	m.logger.Infof("waiting for leader election lock %s/%s", m.flags.LeaderElectionNamespace, m.flags.LeaderElectionName)
+	return le.Run(func() error {
+		return op.Run(stopC)
+	})
+}
+
+// getMetricsRecorder returns the metrics recorder and starts serving the
+// metrics in background if enabled.
+func (m *Main) getMetricsRecorder() metrics.Recorder {
+	if m.flags.MetricsAddress == "" {
+		return metrics.Dummy
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector())
+	metricsRec := metrics.NewPrometheus(reg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	go func() {
+		m.logger.Infof("serving metrics on %s", m.flags.MetricsAddress)
+		if err := http.ListenAndServe(m.flags.MetricsAddress, mux); err != nil {
+			m.logger.Errorf("error serving metrics: %s", err)
+		}
+	}()
+
+	return metricsRec
 }
 
 // getKubernetesClients returns all the required clients to communicate with
 // kubernetes cluster: CRD type client, pod terminator types client, kubernetes core types client.
 func (m *Main) getKubernetesClients() (floatingipk8scli.Interface, crd.Interface, kubernetes.Interface, error) {
-	var err error
-	var cfg *rest.Config
-
-	// If devel mode then use configuration flag path.
-	if m.flags.Development {
-		cfg, err = clientcmd.BuildConfigFromFlags("", m.flags.KubeConfig)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("could not load configuration: %s", err)
-		}
-	} else {
-		cfg, err = rest.InClusterConfig()
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("error loading kubernetes configuration inside cluster, check app is running outside kubernetes cluster or run in development mode: %s", err)
-		}
+	cfg, err := getRestConfig(m.flags.Development, m.flags.KubeConfig)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	// Create clients.
@@ -101,6 +140,30 @@ func (m *Main) getKubernetesClients() (floatingipk8scli.Interface, crd.Interface
 	return fipCli, crdCli, k8sCli, nil
 }
 
+// getRestConfig returns the configuration to reach the kubernetes api from
+// inside the cluster or in development mode from the kubeconfig.
+func getRestConfig(development bool, kubeconfig string) (*rest.Config, error) {
+	// If devel mode then use configuration flag path.
+	if development {
+		cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("could not load configuration: %s", err)
+		}
+		return cfg, nil
+	}
+
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubernetes configuration inside cluster, check app is running outside kubernetes cluster or run in development mode: %s", err)
+	}
+	return cfg, nil
+}
+
+// runner is a program that runs until it is stopped.
+type runner interface {
+	Run(stopC <-chan struct{}) error
+}
+
 func main() {
 	logger := &applogger.Std{}
 
@@ -108,7 +171,12 @@ func main() {
 	finishC := make(chan error)
 	signalC := make(chan os.Signal, 1)
 	signal.Notify(signalC, syscall.SIGTERM, syscall.SIGINT)
-	m := New(logger)
+	var m runner
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		m = NewAgentMain(logger, os.Args[2:])
+	} else {
+		m = New(logger)
+	}
 
 	// Run in background the operator.
 	go func() {
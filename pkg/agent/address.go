@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AddressManager knows how to manage the addresses of the interface the
+// floating ips are configured on.
+type AddressManager interface {
+	// Addresses returns the addresses of the interface.
+	Addresses() ([]*net.IPNet, error)
+	// Add adds the address to the interface.
+	Add(addr *net.IPNet) error
+	// Delete removes the address from the interface.
+	Delete(addr *net.IPNet) error
+}
+
+// floatingIPAddress returns the address that is configured on the interface
+// for the ip of a floating ip status. IPv4 floating ips are configured as
+// /32, for the /64 network of IPv6 floating ips the first address is used.
+func floatingIPAddress(ip string) (*net.IPNet, error) {
+	if !strings.Contains(ip, "/") {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return nil, fmt.Errorf("invalid ip address %s", ip)
+		}
+		if v4 := parsed.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: parsed, Mask: net.CIDRMask(64, 128)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := make(net.IP, len(network.IP))
+	copy(addr, network.IP)
+	addr[len(addr)-1]++
+	return &net.IPNet{IP: addr, Mask: network.Mask}, nil
+}
+
+// containsAddress checks if the address is in the list of addresses.
+func containsAddress(addrs []*net.IPNet, addr *net.IPNet) bool {
+	for _, a := range addrs {
+		if a.IP.Equal(addr.IP) && a.Mask.String() == addr.Mask.String() {
+			return true
+		}
+	}
+	return false
+}
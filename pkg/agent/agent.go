@@ -0,0 +1,307 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	hcloudfloatingipoperator "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud"
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	floatingipk8scli "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
+)
+
+// Agent configures the floating ips that are assigned to its node on an
+// interface of the node and removes all others. The configured floating
+// ips are reported in an annotation of the node.
+type Agent struct {
+	cfg       Config
+	k8sCli    kubernetes.Interface
+	addrs     AddressManager
+	announcer Announcer
+	logger    log.Logger
+	informer  cache.SharedIndexInformer
+	triggerC  chan struct{}
+}
+
+// NewAgent returns a new node agent.
+func NewAgent(cfg Config, k8sCli kubernetes.Interface, fipCli floatingipk8scli.Interface, addrs AddressManager, announcer Announcer, logger log.Logger) *Agent {
+	a := &Agent{
+		cfg:       cfg,
+		k8sCli:    k8sCli,
+		addrs:     addrs,
+		announcer: announcer,
+		logger:    logger,
+		triggerC:  make(chan struct{}, 1),
+	}
+
+	a.informer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return fipCli.HcloudV1alpha1().FloatingIPs().List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return fipCli.HcloudV1alpha1().FloatingIPs().Watch(options)
+			},
+		},
+		&hcloudv1alpha1.FloatingIP{},
+		0,
+		cache.Indexers{},
+	)
+	a.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(_ interface{}) { a.trigger() },
+		UpdateFunc: func(_, _ interface{}) { a.trigger() },
+		DeleteFunc: func(_ interface{}) { a.trigger() },
+	})
+
+	return a
+}
+
+// trigger requests a sync, requests are merged while one is pending.
+func (a *Agent) trigger() {
+	select {
+	case a.triggerC <- struct{}{}:
+	default:
+	}
+}
+
+// Run syncs the addresses of the interface on every change of the floating
+// ip resources and at every resync period until stopped.
+func (a *Agent) Run(stopC <-chan struct{}) error {
+	a.logger.Infof("starting agent for node %s on interface %s", a.cfg.NodeName, a.cfg.Interface)
+
+	go a.informer.Run(stopC)
+	if !cache.WaitForCacheSync(stopC, a.informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for informers to sync")
+	}
+
+	for {
+		if err := a.sync(stopC); err != nil {
+			a.logger.Errorf("error syncing floating ips: %s", err)
+		}
+
+		select {
+		case <-time.After(a.cfg.ResyncPeriod):
+		case <-a.triggerC:
+		case <-stopC:
+			return nil
+		}
+	}
+}
+
+// sync adds the addresses of the floating ips assigned to the node to the
+// interface, removes the addresses of all other floating ips and the
+// addresses it added before that are no longer desired, and reports the
+// configured floating ips. Announcements of added addresses stop once the
+// stop channel is closed.
+func (a *Agent) sync(stopC <-chan struct{}) error {
+	node, err := a.k8sCli.CoreV1().Nodes().Get(a.cfg.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	current, err := a.addrs.Addresses()
+	if err != nil {
+		return err
+	}
+
+	desired := map[string]*net.IPNet{}
+	stale := managedAddresses(node)
+	for _, obj := range a.informer.GetStore().List() {
+		fip, ok := obj.(*hcloudv1alpha1.FloatingIP)
+		if !ok {
+			continue
+		}
+
+		for ip, nodeName := range assignments(fip) {
+			addr, err := floatingIPAddress(ip)
+			if err != nil {
+				a.logger.Warningf("ignoring ip %s of %s: %s", ip, fip.Name, err)
+				continue
+			}
+			stale = appendAddress(stale, addr)
+			if nodeName == a.cfg.NodeName {
+				desired[ip] = addr
+			}
+		}
+	}
+
+	configured := []string{}
+	managed := []*net.IPNet{}
+	var firstErr error
+	for ip, addr := range desired {
+		if !containsAddress(current, addr) {
+			if err := a.addrs.Add(addr); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			a.logger.Infof("added %s to %s", addr, a.cfg.Interface)
+			go a.announce(addr, stopC)
+		}
+		configured = append(configured, ip)
+		managed = appendAddress(managed, addr)
+	}
+
+	for _, addr := range stale {
+		if isDesired(desired, addr) || !containsAddress(current, addr) {
+			continue
+		}
+		if err := a.addrs.Delete(addr); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			// Keep tracking the address so the removal is retried.
+			managed = appendAddress(managed, addr)
+			continue
+		}
+		a.logger.Infof("removed %s from %s", addr, a.cfg.Interface)
+	}
+
+	if err := a.report(node, configured, managed); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// announce tells the neighbors that the address moved to the node, so
+// upstream caches stop sending its traffic to the previous node. The
+// remaining announcements are dropped once the stop channel is closed.
+func (a *Agent) announce(addr *net.IPNet, stopC <-chan struct{}) {
+	for i := 0; i < a.cfg.AnnounceCount; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(a.cfg.AnnounceInterval):
+			case <-stopC:
+				return
+			}
+		}
+		if err := a.announcer.Announce(addr); err != nil {
+			a.logger.Errorf("error announcing %s on %s: %s", addr, a.cfg.Interface, err)
+			return
+		}
+	}
+}
+
+// report writes the configured floating ips and the managed addresses to
+// the annotations of the node if they changed.
+func (a *Agent) report(node *corev1.Node, configured []string, managed []*net.IPNet) error {
+	sort.Strings(configured)
+	addrs := make([]string, len(managed))
+	for i, addr := range managed {
+		addrs[i] = addr.String()
+	}
+	sort.Strings(addrs)
+
+	annotations := map[string]string{
+		hcloudfloatingipoperator.ConfiguredFloatingIPsAnnotation: strings.Join(configured, ","),
+		hcloudfloatingipoperator.ManagedAddressesAnnotation:      strings.Join(addrs, ","),
+	}
+	changed := false
+	for key, value := range annotations {
+		if current, ok := node.Annotations[key]; !ok || current != value {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = a.k8sCli.CoreV1().Nodes().Patch(a.cfg.NodeName, types.MergePatchType, patch)
+	return err
+}
+
+// assignments returns the node of every floating ip of the resource by the
+// ip as written to the status.
+func assignments(fip *hcloudv1alpha1.FloatingIP) map[string]string {
+	result := map[string]string{}
+	if len(fip.Status.IPs) > 0 {
+		for _, a := range fip.Status.IPs {
+			if a.IP != "" {
+				result[a.IP] = a.NodeName
+			}
+		}
+		return result
+	}
+
+	if fip.Status.IP != "" {
+		result[fip.Status.IP] = fip.Status.NodeName
+	}
+	return result
+}
+
+// managedAddresses returns the addresses the agent reported as added by it
+// in the annotation of the node.
+func managedAddresses(node *corev1.Node) []*net.IPNet {
+	result := []*net.IPNet{}
+	for _, value := range strings.Split(node.Annotations[hcloudfloatingipoperator.ManagedAddressesAnnotation], ",") {
+		if value == "" {
+			continue
+		}
+		ip, network, err := net.ParseCIDR(value)
+		if err != nil {
+			continue
+		}
+		result = appendAddress(result, &net.IPNet{IP: ip, Mask: network.Mask})
+	}
+	return result
+}
+
+// appendAddress appends the address if it is not in the list yet.
+func appendAddress(addrs []*net.IPNet, addr *net.IPNet) []*net.IPNet {
+	if containsAddress(addrs, addr) {
+		return addrs
+	}
+	return append(addrs, addr)
+}
+
+// isDesired checks if the address is one of the desired addresses.
+func isDesired(desired map[string]*net.IPNet, addr *net.IPNet) bool {
+	for _, d := range desired {
+		if containsAddress([]*net.IPNet{d}, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasReported checks if an agent ever reported the configured floating ips
+// of the node.
+func HasReported(node *corev1.Node) bool {
+	_, ok := node.Annotations[hcloudfloatingipoperator.ConfiguredFloatingIPsAnnotation]
+	return ok
+}
+
+// ConfiguredFloatingIPs returns the floating ips the agent reported as
+// configured on the node.
+func ConfiguredFloatingIPs(node *corev1.Node) map[string]bool {
+	result := map[string]bool{}
+	value := node.Annotations[hcloudfloatingipoperator.ConfiguredFloatingIPsAnnotation]
+	for _, ip := range strings.Split(value, ",") {
+		if ip != "" {
+			result[ip] = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	hcloudfloatingipoperator "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud"
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	floatingipfake "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned/fake"
+)
+
+type nopAnnouncer struct{}
+
+func (n *nopAnnouncer) Announce(addr *net.IPNet) error { return nil }
+
+type countingAnnouncer struct {
+	count int
+}
+
+func (c *countingAnnouncer) Announce(addr *net.IPNet) error {
+	c.count++
+	return nil
+}
+
+func floatingIP(name, ip, node string) *hcloudv1alpha1.FloatingIP {
+	return &hcloudv1alpha1.FloatingIP{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: hcloudv1alpha1.FloatingIPStatus{
+			IP:       ip,
+			NodeName: node,
+		},
+	}
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name        string
+		fips        []*hcloudv1alpha1.FloatingIP
+		present     []string
+		annotations map[string]string
+		expAddrs    []string
+		expAbsent   []string
+		expConfig   string
+		expManaged  string
+	}{
+		{
+			name:       "Adds the floating ips assigned to the node",
+			fips:       []*hcloudv1alpha1.FloatingIP{floatingIP("web", "192.0.2.10", "node1"), floatingIP("v6", "2001:db8:1::/64", "node1")},
+			expAddrs:   []string{"192.0.2.10/32", "2001:db8:1::1/64"},
+			expConfig:  "192.0.2.10,2001:db8:1::/64",
+			expManaged: "192.0.2.10/32,2001:db8:1::1/64",
+		},
+		{
+			name:       "Removes floating ips assigned to other nodes",
+			fips:       []*hcloudv1alpha1.FloatingIP{floatingIP("web", "192.0.2.10", "node2")},
+			present:    []string{"192.0.2.10/32"},
+			expAbsent:  []string{"192.0.2.10/32"},
+			expConfig:  "",
+			expManaged: "",
+		},
+		{
+			name:    "Removes managed addresses of deleted floating ips",
+			present: []string{"192.0.2.11/32"},
+			annotations: map[string]string{
+				hcloudfloatingipoperator.ManagedAddressesAnnotation: "192.0.2.11/32",
+			},
+			expAbsent:  []string{"192.0.2.11/32"},
+			expConfig:  "",
+			expManaged: "",
+		},
+		{
+			name:       "Keeps addresses it does not manage",
+			fips:       []*hcloudv1alpha1.FloatingIP{floatingIP("web", "192.0.2.10", "node1")},
+			present:    []string{"10.0.0.5/24"},
+			expAddrs:   []string{"10.0.0.5/24", "192.0.2.10/32"},
+			expConfig:  "192.0.2.10",
+			expManaged: "192.0.2.10/32",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inNetns(t, func() error {
+				if err := addDummy("fip0"); err != nil {
+					return err
+				}
+				addrs := NewNetlink("fip0")
+				for _, p := range test.present {
+					ip, network, _ := net.ParseCIDR(p)
+					if err := addrs.Add(&net.IPNet{IP: ip, Mask: network.Mask}); err != nil {
+						return err
+					}
+				}
+
+				node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: test.annotations}}
+				k8sCli := k8sfake.NewSimpleClientset(node)
+				cfg := Config{NodeName: "node1", Interface: "fip0"}
+				a := NewAgent(cfg, k8sCli, floatingipfake.NewSimpleClientset(), addrs, &nopAnnouncer{}, kooperlog.Dummy)
+				for _, fip := range test.fips {
+					if err := a.informer.GetStore().Add(fip); err != nil {
+						return err
+					}
+				}
+
+				if err := a.sync(nil); err != nil {
+					return fmt.Errorf("error syncing: %s", err)
+				}
+
+				current, err := addrs.Addresses()
+				if err != nil {
+					return err
+				}
+				for _, exp := range test.expAddrs {
+					ip, network, _ := net.ParseCIDR(exp)
+					if !containsAddress(current, &net.IPNet{IP: ip, Mask: network.Mask}) {
+						return fmt.Errorf("expected %s in %v", exp, current)
+					}
+				}
+				for _, exp := range test.expAbsent {
+					ip, network, _ := net.ParseCIDR(exp)
+					if containsAddress(current, &net.IPNet{IP: ip, Mask: network.Mask}) {
+						return fmt.Errorf("expected no %s in %v", exp, current)
+					}
+				}
+
+				got, err := k8sCli.CoreV1().Nodes().Get("node1", metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				exp := map[string]string{
+					hcloudfloatingipoperator.ConfiguredFloatingIPsAnnotation: test.expConfig,
+					hcloudfloatingipoperator.ManagedAddressesAnnotation:      test.expManaged,
+				}
+				if !reflect.DeepEqual(got.Annotations, exp) {
+					return fmt.Errorf("expected annotations %v, got %v", exp, got.Annotations)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestAgentAnnounce(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int
+		interval time.Duration
+		stop     bool
+		expCount int
+	}{
+		{
+			name:     "Announces the address count times",
+			count:    3,
+			expCount: 3,
+		},
+		{
+			name: "Announcing is disabled with a count of 0",
+		},
+		{
+			name:     "Stopped agent drops the remaining announcements",
+			count:    3,
+			interval: time.Hour,
+			stop:     true,
+			expCount: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			announcer := &countingAnnouncer{}
+			cfg := Config{NodeName: "node1", Interface: "fip0", AnnounceCount: test.count, AnnounceInterval: test.interval}
+			a := NewAgent(cfg, k8sfake.NewSimpleClientset(), floatingipfake.NewSimpleClientset(), nil, announcer, kooperlog.Dummy)
+
+			stopC := make(chan struct{})
+			if test.stop {
+				close(stopC)
+			}
+			done := make(chan struct{})
+			go func() {
+				a.announce(&net.IPNet{IP: net.ParseIP("192.0.2.10"), Mask: net.CIDRMask(32, 32)}, stopC)
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("announcing did not return")
+			}
+			if announcer.count != test.expCount {
+				t.Errorf("expected %d announcements, got %d", test.expCount, announcer.count)
+			}
+		})
+	}
+}
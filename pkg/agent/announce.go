@@ -0,0 +1,13 @@
+package agent
+
+import (
+	"net"
+)
+
+// Announcer knows how to tell the neighbors on the link that an address
+// moved to the interface.
+type Announcer interface {
+	// Announce sends a gratuitous arp for ipv4 and an unsolicited neighbor
+	// advertisement for ipv6 addresses.
+	Announce(addr *net.IPNet) error
+}
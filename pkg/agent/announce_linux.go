@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+const (
+	// ethPARP is the ethertype of arp.
+	ethPARP = 0x0806
+	// icmpv6NeighborAdvertisement is the icmpv6 type of neighbor
+	// advertisements.
+	icmpv6NeighborAdvertisement = 136
+	// naFlagOverride makes receivers replace their cached link-layer
+	// address.
+	naFlagOverride = 0x20
+	// ndOptTargetLinkLayerAddress is the neighbor discovery option holding
+	// the link-layer address of the target.
+	ndOptTargetLinkLayerAddress = 2
+)
+
+// rawAnnouncer sends gratuitous arp and unsolicited neighbor advertisements
+// through raw sockets.
+type rawAnnouncer struct {
+	iface string
+}
+
+// NewAnnouncer returns an announcer for the interface with the name.
+func NewAnnouncer(iface string) Announcer {
+	return &rawAnnouncer{
+		iface: iface,
+	}
+}
+
+// Announce satisfies Announcer interface.
+func (r *rawAnnouncer) Announce(addr *net.IPNet) error {
+	link, err := net.InterfaceByName(r.iface)
+	if err != nil {
+		return err
+	}
+	if len(link.HardwareAddr) != 6 {
+		return fmt.Errorf("interface %s has no ethernet address", r.iface)
+	}
+
+	if v4 := addr.IP.To4(); v4 != nil {
+		return sendGratuitousARP(link, v4)
+	}
+	return sendUnsolicitedNA(link, addr.IP.To16())
+}
+
+// sendGratuitousARP broadcasts an arp request for the ip with the ip as
+// sender on the interface.
+func sendGratuitousARP(link *net.Interface, ip net.IP) error {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ethPARP)))
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	broadcast := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	frame := make([]byte, 0, 42)
+	// Ethernet header.
+	frame = append(frame, broadcast...)
+	frame = append(frame, link.HardwareAddr...)
+	frame = append(frame, ethPARP>>8, ethPARP&0xff)
+	// ARP request for ethernet and ipv4 with the ip as sender and target.
+	frame = append(frame, 0x00, 0x01, 0x08, 0x00, 6, 4, 0x00, 0x01)
+	frame = append(frame, link.HardwareAddr...)
+	frame = append(frame, ip...)
+	frame = append(frame, 0, 0, 0, 0, 0, 0)
+	frame = append(frame, ip...)
+
+	sa := &syscall.SockaddrLinklayer{
+		Protocol: htons(ethPARP),
+		Ifindex:  link.Index,
+		Halen:    6,
+	}
+	copy(sa.Addr[:], broadcast)
+
+	return syscall.Sendto(fd, frame, 0, sa)
+}
+
+// sendUnsolicitedNA sends a neighbor advertisement for the ip to all nodes
+// on the interface.
+func sendUnsolicitedNA(link *net.Interface, ip net.IP) error {
+	fd, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_RAW, syscall.IPPROTO_ICMPV6)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// Neighbor discovery messages are only accepted with a hop limit of 255.
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, 255); err != nil {
+		return err
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, link.Index); err != nil {
+		return err
+	}
+
+	// The kernel fills in the checksum of icmpv6 messages.
+	msg := make([]byte, 0, 32)
+	msg = append(msg, icmpv6NeighborAdvertisement, 0, 0, 0)
+	msg = append(msg, naFlagOverride, 0, 0, 0)
+	msg = append(msg, ip...)
+	msg = append(msg, ndOptTargetLinkLayerAddress, 1)
+	msg = append(msg, link.HardwareAddr...)
+
+	sa := &syscall.SockaddrInet6{
+		ZoneId: uint32(link.Index),
+	}
+	copy(sa.Addr[:], net.IPv6linklocalallnodes)
+
+	return syscall.Sendto(fd, msg, 0, sa)
+}
+
+// htons converts the short to network byte order.
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
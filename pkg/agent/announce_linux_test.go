@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const ethPAll = 0x0003
+
+func TestAnnounce(t *testing.T) {
+	tests := []struct {
+		name  string
+		ip    string
+		check func(frame []byte, mac net.HardwareAddr, ip net.IP) error
+	}{
+		{name: "ipv4 gratuitous arp", ip: "192.0.2.10", check: checkGratuitousARP},
+		{name: "ipv6 unsolicited neighbor advertisement", ip: "2001:db8:1::/64", check: checkUnsolicitedNA},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inNetns(t, func() error {
+				if err := addVeth("fip0", "fip0p"); err != nil {
+					return err
+				}
+				link, err := net.InterfaceByName("fip0")
+				if err != nil {
+					return err
+				}
+				addr, err := floatingIPAddress(test.ip)
+				if err != nil {
+					return err
+				}
+
+				fd, err := capture("fip0p")
+				if err != nil {
+					return err
+				}
+				defer syscall.Close(fd)
+
+				// The link-local address needed to send ipv6 may still be
+				// tentative, so the announcement is retried until the peer
+				// sees it.
+				announcer := NewAnnouncer("fip0")
+				deadline := time.Now().Add(5 * time.Second)
+				var lastErr error
+				for time.Now().Before(deadline) {
+					if err := announcer.Announce(addr); err != nil {
+						lastErr = err
+						time.Sleep(100 * time.Millisecond)
+						continue
+					}
+					frame, err := receive(fd, link.HardwareAddr)
+					if err != nil {
+						lastErr = err
+						continue
+					}
+					return test.check(frame, link.HardwareAddr, addr.IP)
+				}
+				return fmt.Errorf("no announcement received: %v", lastErr)
+			})
+		})
+	}
+}
+
+// capture opens a packet socket receiving all frames of the interface.
+func capture(name string) (int, error) {
+	link, err := net.InterfaceByName(name)
+	if err != nil {
+		return 0, err
+	}
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ethPAll)))
+	if err != nil {
+		return 0, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(ethPAll), Ifindex: link.Index}); err != nil {
+		syscall.Close(fd)
+		return 0, err
+	}
+	tv := syscall.NsecToTimeval(int64(500 * time.Millisecond))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return 0, err
+	}
+	return fd, nil
+}
+
+// receive returns the next arp or icmpv6 frame sent by the mac, skipping
+// the router solicitations and other traffic of the link.
+func receive(fd int, mac net.HardwareAddr) ([]byte, error) {
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		frame := buf[:n]
+		if n < 14 || !bytes.Equal(frame[6:12], mac) {
+			continue
+		}
+		switch {
+		case frame[12] == 0x08 && frame[13] == 0x06:
+			return frame, nil
+		case frame[12] == 0x86 && frame[13] == 0xdd && n >= 55 && frame[20] == syscall.IPPROTO_ICMPV6 && frame[54] == icmpv6NeighborAdvertisement:
+			return frame, nil
+		}
+	}
+}
+
+func checkGratuitousARP(frame []byte, mac net.HardwareAddr, ip net.IP) error {
+	if len(frame) < 42 {
+		return fmt.Errorf("arp frame too short: %d bytes", len(frame))
+	}
+	broadcast := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if !bytes.Equal(frame[0:6], broadcast) {
+		return fmt.Errorf("expected destination %s, got %s", broadcast, net.HardwareAddr(frame[0:6]))
+	}
+
+	arp := frame[14:]
+	if op := int(arp[6])<<8 | int(arp[7]); op != 1 {
+		return fmt.Errorf("expected arp request, got opcode %d", op)
+	}
+	if !bytes.Equal(arp[8:14], mac) {
+		return fmt.Errorf("expected sender mac %s, got %s", mac, net.HardwareAddr(arp[8:14]))
+	}
+	if !net.IP(arp[14:18]).Equal(ip) {
+		return fmt.Errorf("expected sender ip %s, got %s", ip, net.IP(arp[14:18]))
+	}
+	if !net.IP(arp[24:28]).Equal(ip) {
+		return fmt.Errorf("expected target ip %s, got %s", ip, net.IP(arp[24:28]))
+	}
+	return nil
+}
+
+func checkUnsolicitedNA(frame []byte, mac net.HardwareAddr, ip net.IP) error {
+	if len(frame) < 86 {
+		return fmt.Errorf("neighbor advertisement frame too short: %d bytes", len(frame))
+	}
+
+	ipv6 := frame[14:]
+	if hops := ipv6[7]; hops != 255 {
+		return fmt.Errorf("expected hop limit 255, got %d", hops)
+	}
+	if dst := net.IP(ipv6[24:40]); !dst.Equal(net.IPv6linklocalallnodes) {
+		return fmt.Errorf("expected destination %s, got %s", net.IPv6linklocalallnodes, dst)
+	}
+
+	na := ipv6[40:]
+	if flags := na[4]; flags != naFlagOverride {
+		return fmt.Errorf("expected flags %#x, got %#x", naFlagOverride, flags)
+	}
+	if target := net.IP(na[8:24]); !target.Equal(ip) {
+		return fmt.Errorf("expected target %s, got %s", ip, target)
+	}
+	if na[24] != ndOptTargetLinkLayerAddress || na[25] != 1 {
+		return fmt.Errorf("expected target link-layer address option, got type %d length %d", na[24], na[25])
+	}
+	if !bytes.Equal(na[26:32], mac) {
+		return fmt.Errorf("expected link-layer address %s, got %s", mac, net.HardwareAddr(na[26:32]))
+	}
+	return nil
+}
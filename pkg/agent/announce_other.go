@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// unsupportedAnnouncer is the announcer on systems without raw packet
+// sockets.
+type unsupportedAnnouncer struct{}
+
+// NewAnnouncer returns an announcer that fails on every call, announcing is
+// only available on linux.
+func NewAnnouncer(iface string) Announcer {
+	return &unsupportedAnnouncer{}
+}
+
+// Announce satisfies Announcer interface.
+func (u *unsupportedAnnouncer) Announce(addr *net.IPNet) error {
+	return fmt.Errorf("announcing addresses is not supported on %s", runtime.GOOS)
+}
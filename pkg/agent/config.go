@@ -0,0 +1,23 @@
+package agent
+
+import (
+	"time"
+)
+
+// Config is the configuration of the node agent.
+type Config struct {
+	// NodeName is the name of the node the agent runs on.
+	NodeName string
+	// Interface is the name of the interface the floating ips are
+	// configured on.
+	Interface string
+	// ResyncPeriod is the time between two syncs without changes of the
+	// floating ip resources.
+	ResyncPeriod time.Duration
+	// AnnounceCount is the number of gratuitous arps or unsolicited
+	// neighbor advertisements sent after a floating ip was added, 0
+	// disables announcing.
+	AnnounceCount int
+	// AnnounceInterval is the time between two announcements.
+	AnnounceInterval time.Duration
+}
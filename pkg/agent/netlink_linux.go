@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// netlink manages the addresses of an interface through rtnetlink.
+type netlink struct {
+	iface string
+	seq   uint32
+}
+
+// NewNetlink returns an address manager for the interface with the name.
+func NewNetlink(iface string) AddressManager {
+	return &netlink{
+		iface: iface,
+	}
+}
+
+// Addresses satisfies AddressManager interface.
+func (n *netlink) Addresses() ([]*net.IPNet, error) {
+	link, err := net.InterfaceByName(n.iface)
+	if err != nil {
+		return nil, err
+	}
+
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("error listing addresses: %s", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing addresses: %s", err)
+	}
+
+	addrs := []*net.IPNet{}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+
+		ifa := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		if int(ifa.Index) != link.Index {
+			continue
+		}
+
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing address attributes: %s", err)
+		}
+
+		var ip net.IP
+		for _, attr := range attrs {
+			// IFA_LOCAL is the address of the interface, IFA_ADDRESS is the
+			// peer address on point to point links and the address
+			// otherwise.
+			switch attr.Attr.Type {
+			case syscall.IFA_LOCAL:
+				ip = net.IP(attr.Value)
+			case syscall.IFA_ADDRESS:
+				if ip == nil {
+					ip = net.IP(attr.Value)
+				}
+			}
+		}
+		if ip == nil {
+			continue
+		}
+
+		bits := 8 * net.IPv6len
+		if ifa.Family == syscall.AF_INET {
+			bits = 8 * net.IPv4len
+		}
+		addrs = append(addrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(int(ifa.Prefixlen), bits)})
+	}
+
+	return addrs, nil
+}
+
+// Add satisfies AddressManager interface.
+func (n *netlink) Add(addr *net.IPNet) error {
+	return n.request(syscall.RTM_NEWADDR, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, addr)
+}
+
+// Delete satisfies AddressManager interface.
+func (n *netlink) Delete(addr *net.IPNet) error {
+	return n.request(syscall.RTM_DELADDR, 0, addr)
+}
+
+// request sends an address request for the interface and waits for the
+// acknowledgement of the kernel.
+func (n *netlink) request(msgType uint16, flags uint16, addr *net.IPNet) error {
+	link, err := net.InterfaceByName(n.iface)
+	if err != nil {
+		return err
+	}
+
+	family := syscall.AF_INET6
+	ip := addr.IP.To16()
+	if v4 := addr.IP.To4(); v4 != nil {
+		family = syscall.AF_INET
+		ip = v4
+	}
+	prefixLen, _ := addr.Mask.Size()
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	seq := atomic.AddUint32(&n.seq, 1)
+	msg := newNetlinkMessage(msgType, flags|syscall.NLM_F_REQUEST|syscall.NLM_F_ACK, seq, &syscall.IfAddrmsg{
+		Family:    uint8(family),
+		Prefixlen: uint8(prefixLen),
+		Index:     uint32(link.Index),
+	}, map[uint16][]byte{
+		syscall.IFA_LOCAL:   ip,
+		syscall.IFA_ADDRESS: ip,
+	})
+
+	if err := syscall.Sendto(fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, syscall.Getpagesize())
+	for {
+		nr, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return err
+		}
+
+		msgs, err := syscall.ParseNetlinkMessage(buf[:nr])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != seq || m.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+			// The error message starts with the negated errno, 0 is the
+			// acknowledgement.
+			errno := *(*int32)(unsafe.Pointer(&m.Data[0]))
+			if errno != 0 {
+				return fmt.Errorf("error changing address %s of %s: %s", addr, n.iface, syscall.Errno(-errno))
+			}
+			return nil
+		}
+	}
+}
+
+// newNetlinkMessage serializes a netlink message with the address header
+// and the attributes in native byte order.
+func newNetlinkMessage(msgType, flags uint16, seq uint32, ifa *syscall.IfAddrmsg, attrs map[uint16][]byte) []byte {
+	length := syscall.NLMSG_HDRLEN + syscall.SizeofIfAddrmsg
+	for _, value := range attrs {
+		length += rtaAlign(syscall.SizeofRtAttr + len(value))
+	}
+
+	b := make([]byte, length)
+	*(*syscall.NlMsghdr)(unsafe.Pointer(&b[0])) = syscall.NlMsghdr{
+		Len:   uint32(length),
+		Type:  msgType,
+		Flags: flags,
+		Seq:   seq,
+	}
+	*(*syscall.IfAddrmsg)(unsafe.Pointer(&b[syscall.NLMSG_HDRLEN])) = *ifa
+
+	offset := syscall.NLMSG_HDRLEN + syscall.SizeofIfAddrmsg
+	for attrType, value := range attrs {
+		*(*syscall.RtAttr)(unsafe.Pointer(&b[offset])) = syscall.RtAttr{
+			Len:  uint16(syscall.SizeofRtAttr + len(value)),
+			Type: attrType,
+		}
+		copy(b[offset+syscall.SizeofRtAttr:], value)
+		offset += rtaAlign(syscall.SizeofRtAttr + len(value))
+	}
+
+	return b
+}
+
+// rtaAlign rounds the length up to the alignment of route attributes.
+func rtaAlign(length int) int {
+	return (length + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+}
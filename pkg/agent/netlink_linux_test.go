@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestNetlink(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+	}{
+		{name: "ipv4 floating ip", ip: "192.0.2.10"},
+		{name: "ipv6 floating ip", ip: "2001:db8:1::/64"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inNetns(t, func() error {
+				if err := addDummy("fip0"); err != nil {
+					return err
+				}
+				addr, err := floatingIPAddress(test.ip)
+				if err != nil {
+					return err
+				}
+
+				n := NewNetlink("fip0")
+				if err := n.Add(addr); err != nil {
+					return fmt.Errorf("error adding %s: %s", addr, err)
+				}
+				if err := n.Add(addr); err == nil {
+					return fmt.Errorf("adding %s twice succeeded", addr)
+				}
+
+				addrs, err := n.Addresses()
+				if err != nil {
+					return err
+				}
+				if !containsAddress(addrs, addr) {
+					return fmt.Errorf("expected %s in %v", addr, addrs)
+				}
+
+				if err := n.Delete(addr); err != nil {
+					return fmt.Errorf("error deleting %s: %s", addr, err)
+				}
+				addrs, err = n.Addresses()
+				if err != nil {
+					return err
+				}
+				if containsAddress(addrs, addr) {
+					return fmt.Errorf("expected no %s in %v", addr, addrs)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestNetlinkUnknownInterface(t *testing.T) {
+	inNetns(t, func() error {
+		n := NewNetlink("missing0")
+		if _, err := n.Addresses(); err == nil {
+			return fmt.Errorf("listing addresses of a missing interface succeeded")
+		}
+		if err := n.Add(&net.IPNet{IP: net.ParseIP("192.0.2.10"), Mask: net.CIDRMask(32, 32)}); err == nil {
+			return fmt.Errorf("adding an address to a missing interface succeeded")
+		}
+		return nil
+	})
+}
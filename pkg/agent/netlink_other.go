@@ -0,0 +1,32 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// unsupported is the address manager on systems without netlink.
+type unsupported struct{}
+
+// NewNetlink returns an address manager that fails on every call, netlink
+// is only available on linux.
+func NewNetlink(iface string) AddressManager {
+	return &unsupported{}
+}
+
+func (u *unsupported) err() error {
+	return fmt.Errorf("managing addresses is not supported on %s", runtime.GOOS)
+}
+
+// Addresses satisfies AddressManager interface.
+func (u *unsupported) Addresses() ([]*net.IPNet, error) { return nil, u.err() }
+
+// Add satisfies AddressManager interface.
+func (u *unsupported) Add(addr *net.IPNet) error { return u.err() }
+
+// Delete satisfies AddressManager interface.
+func (u *unsupported) Delete(addr *net.IPNet) error { return u.err() }
@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+const (
+	iflaLinkInfo = 18
+	iflaInfoKind = 1
+	iflaInfoData = 2
+	vethInfoPeer = 1
+)
+
+// unshareError is returned if the test could not enter a new network
+// namespace.
+type unshareError struct {
+	err error
+}
+
+func (e *unshareError) Error() string {
+	return fmt.Sprintf("error creating network namespace: %s", e.err)
+}
+
+// inNetns runs the function in a new network namespace and skips the test
+// without CAP_NET_ADMIN. Goroutines started by the function run outside of
+// the namespace.
+func inNetns(t *testing.T, fn func() error) {
+	errC := make(chan error, 1)
+	go func() {
+		// The thread is never unlocked, so it exits with the goroutine
+		// instead of returning to the runtime inside the namespace.
+		runtime.LockOSThread()
+		if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+			errC <- &unshareError{err: err}
+			return
+		}
+		if err := setLinkUp("lo"); err != nil {
+			errC <- err
+			return
+		}
+		errC <- fn()
+	}()
+
+	err := <-errC
+	if uerr, ok := err.(*unshareError); ok {
+		t.Skipf("needs CAP_NET_ADMIN: %s", uerr)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addDummy creates a dummy link with the name and sets it up. Kernels
+// without the dummy driver get one end of a veth pair instead.
+func addDummy(name string) error {
+	info := rtAttr(iflaLinkInfo, rtAttr(iflaInfoKind, []byte("dummy")))
+	err := newLink(name, info)
+	if err == syscall.EOPNOTSUPP {
+		return addVeth(name, name+"p")
+	}
+	if err != nil {
+		return err
+	}
+	return setLinkUp(name)
+}
+
+// addVeth creates a veth pair with the names and sets both ends up.
+func addVeth(name, peer string) error {
+	peerInfo := append(ifInfomsg(0, 0, 0), rtAttr(syscall.IFLA_IFNAME, cString(peer))...)
+	info := rtAttr(iflaLinkInfo,
+		rtAttr(iflaInfoKind, []byte("veth")),
+		rtAttr(iflaInfoData, rtAttr(vethInfoPeer, peerInfo)),
+	)
+	if err := newLink(name, info); err != nil {
+		return err
+	}
+	if err := setLinkUp(name); err != nil {
+		return err
+	}
+	return setLinkUp(peer)
+}
+
+func newLink(name string, info []byte) error {
+	body := ifInfomsg(0, 0, 0)
+	body = append(body, rtAttr(syscall.IFLA_IFNAME, cString(name))...)
+	body = append(body, info...)
+	return rtnetlink(syscall.RTM_NEWLINK, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, body)
+}
+
+func setLinkUp(name string) error {
+	link, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	return rtnetlink(syscall.RTM_NEWLINK, 0, ifInfomsg(int32(link.Index), syscall.IFF_UP, syscall.IFF_UP))
+}
+
+// rtnetlink sends the request and waits for the acknowledgement.
+func rtnetlink(msgType, flags uint16, body []byte) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	hdr := syscall.NlMsghdr{
+		Len:   uint32(syscall.NLMSG_HDRLEN + len(body)),
+		Type:  msgType,
+		Flags: flags | syscall.NLM_F_REQUEST | syscall.NLM_F_ACK,
+		Seq:   1,
+	}
+	msg := append((*[syscall.NLMSG_HDRLEN]byte)(unsafe.Pointer(&hdr))[:], body...)
+	if err := syscall.Sendto(fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, syscall.Getpagesize())
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+			if errno := *(*int32)(unsafe.Pointer(&m.Data[0])); errno != 0 {
+				return syscall.Errno(-errno)
+			}
+			return nil
+		}
+	}
+}
+
+func ifInfomsg(index int32, flags, change uint32) []byte {
+	ifi := syscall.IfInfomsg{
+		Family: syscall.AF_UNSPEC,
+		Index:  index,
+		Flags:  flags,
+		Change: change,
+	}
+	return append([]byte{}, (*[syscall.SizeofIfInfomsg]byte)(unsafe.Pointer(&ifi))[:]...)
+}
+
+// rtAttr serializes a route attribute, nested attributes are passed as
+// several values.
+func rtAttr(attrType uint16, values ...[]byte) []byte {
+	data := []byte{}
+	for _, v := range values {
+		data = append(data, v...)
+	}
+
+	attr := syscall.RtAttr{
+		Len:  uint16(syscall.SizeofRtAttr + len(data)),
+		Type: attrType,
+	}
+	b := append([]byte{}, (*[syscall.SizeofRtAttr]byte)(unsafe.Pointer(&attr))[:]...)
+	b = append(b, data...)
+	return append(b, make([]byte, rtaAlign(len(b))-len(b))...)
+}
+
+func cString(s string) []byte {
+	return append([]byte(s), 0)
+}
@@ -0,0 +1,120 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	"github.com/hetznercloud/hcloud-go/hcloud/schema"
+)
+
+const (
+	// floatingIPsPerPage is the page size of floating ip listings, the
+	// maximum the hcloud api allows.
+	floatingIPsPerPage = 50
+)
+
+// Client knows how to manage the floating ips and servers of the Hetzner
+// Cloud that are used by the operator.
+type Client interface {
+	// FloatingIPs returns all floating ips of the project.
+	FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error)
+	// CreateFloatingIP creates a new floating ip.
+	CreateFloatingIP(ctx context.Context, opts hcloud.FloatingIPCreateOpts) (*hcloud.FloatingIP, error)
+	// DeleteFloatingIP deletes the floating ip.
+	DeleteFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) error
+	// AssignFloatingIP assigns the floating ip to the server.
+	AssignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP, server *hcloud.Server) (*hcloud.Action, error)
+	// UnassignFloatingIP unassigns the floating ip from its server.
+	UnassignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) (*hcloud.Action, error)
+	// Action returns the action with the id or nil if it does not exist.
+	Action(ctx context.Context, id int) (*hcloud.Action, error)
+	// ServerByID returns the server with the id or nil if it does not exist.
+	ServerByID(ctx context.Context, id int) (*hcloud.Server, error)
+	// ServerByName returns the server with the name or nil if it does not exist.
+	ServerByName(ctx context.Context, name string) (*hcloud.Server, error)
+}
+
+// HCloud is the Client implementation backed by the hcloud-go client.
+type HCloud struct {
+	cli *hcloud.Client
+}
+
+// NewHCloud returns a new client that talks to the Hetzner Cloud API.
+func NewHCloud(cli *hcloud.Client) *HCloud {
+	return &HCloud{
+		cli: cli,
+	}
+}
+
+// FloatingIPs satisfies Client interface. The pages are requested directly,
+// the listings of hcloud-go drop the response of failed requests and with
+// it the reset time of the rate limit.
+func (h *HCloud) FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error) {
+	fips := []*hcloud.FloatingIP{}
+	page := 1
+	for page > 0 {
+		path := fmt.Sprintf("/floating_ips?page=%d&per_page=%d", page, floatingIPsPerPage)
+		req, err := h.cli.NewRequest(ctx, "GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var body schema.FloatingIPListResponse
+		resp, err := h.cli.Do(req, &body)
+		if err != nil {
+			return nil, rateLimitError(resp, err)
+		}
+		for _, fip := range body.FloatingIPs {
+			fips = append(fips, hcloud.FloatingIPFromSchema(fip))
+		}
+
+		page = 0
+		if resp.Meta.Pagination != nil {
+			page = resp.Meta.Pagination.NextPage
+		}
+	}
+	return fips, nil
+}
+
+// CreateFloatingIP satisfies Client interface.
+func (h *HCloud) CreateFloatingIP(ctx context.Context, opts hcloud.FloatingIPCreateOpts) (*hcloud.FloatingIP, error) {
+	result, resp, err := h.cli.FloatingIP.Create(ctx, opts)
+	return result.FloatingIP, rateLimitError(resp, err)
+}
+
+// DeleteFloatingIP satisfies Client interface.
+func (h *HCloud) DeleteFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) error {
+	resp, err := h.cli.FloatingIP.Delete(ctx, fip)
+	return rateLimitError(resp, err)
+}
+
+// AssignFloatingIP satisfies Client interface.
+func (h *HCloud) AssignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP, server *hcloud.Server) (*hcloud.Action, error) {
+	action, resp, err := h.cli.FloatingIP.Assign(ctx, fip, server)
+	return action, rateLimitError(resp, err)
+}
+
+// UnassignFloatingIP satisfies Client interface.
+func (h *HCloud) UnassignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) (*hcloud.Action, error) {
+	action, resp, err := h.cli.FloatingIP.Unassign(ctx, fip)
+	return action, rateLimitError(resp, err)
+}
+
+// Action satisfies Client interface.
+func (h *HCloud) Action(ctx context.Context, id int) (*hcloud.Action, error) {
+	action, resp, err := h.cli.Action.GetByID(ctx, id)
+	return action, rateLimitError(resp, err)
+}
+
+// ServerByID satisfies Client interface.
+func (h *HCloud) ServerByID(ctx context.Context, id int) (*hcloud.Server, error) {
+	server, resp, err := h.cli.Server.GetByID(ctx, id)
+	return server, rateLimitError(resp, err)
+}
+
+// ServerByName satisfies Client interface.
+func (h *HCloud) ServerByName(ctx context.Context, name string) (*hcloud.Server, error) {
+	server, resp, err := h.cli.Server.GetByName(ctx, name)
+	return server, rateLimitError(resp, err)
+}
@@ -0,0 +1,314 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
+)
+
+// Names of the client methods used to inject errors.
+const (
+	MethodFloatingIPs        = "FloatingIPs"
+	MethodCreateFloatingIP   = "CreateFloatingIP"
+	MethodDeleteFloatingIP   = "DeleteFloatingIP"
+	MethodAssignFloatingIP   = "AssignFloatingIP"
+	MethodUnassignFloatingIP = "UnassignFloatingIP"
+	MethodServerByID         = "ServerByID"
+	MethodServerByName       = "ServerByName"
+	MethodAction             = "Action"
+)
+
+// Assignment is a floating ip assignment made through the fake client. A
+// ServerID of 0 is an unassignment.
+type Assignment struct {
+	FloatingIPID int
+	ServerID     int
+}
+
+// Client is an in-memory cloud.Client. It returns copies of the stored
+// resources just like the API would.
+type Client struct {
+	floatingIPs []*hcloud.FloatingIP
+	servers     []*hcloud.Server
+	assignments []Assignment
+	errors      map[string]error
+	latency     time.Duration
+	actionID    int
+	actions     map[int]*hcloud.Action
+	newStatus   hcloud.ActionStatus
+	lastID      int
+	mutex       sync.Mutex
+}
+
+var _ cloud.Client = &Client{}
+
+// NewClient returns a fake client that holds the given resources.
+func NewClient(fips []*hcloud.FloatingIP, servers []*hcloud.Server) *Client {
+	return &Client{
+		floatingIPs: fips,
+		servers:     servers,
+		errors:      map[string]error{},
+		actions:     map[int]*hcloud.Action{},
+		newStatus:   hcloud.ActionStatusSuccess,
+	}
+}
+
+// SetError makes the method return the error on every call. Passing a nil
+// error removes the injected error.
+func (c *Client) SetError(method string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err == nil {
+		delete(c.errors, method)
+		return
+	}
+	c.errors[method] = err
+}
+
+// SetActionStatus sets the status of the actions started from now on. The
+// status of an action never changes after it was started.
+func (c *Client) SetActionStatus(status hcloud.ActionStatus) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.newStatus = status
+}
+
+// SetLatency adds the latency to every call.
+func (c *Client) SetLatency(latency time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.latency = latency
+}
+
+// Assignments returns all assignments made through the client.
+func (c *Client) Assignments() []Assignment {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	assignments := make([]Assignment, len(c.assignments))
+	copy(assignments, c.assignments)
+	return assignments
+}
+
+// call simulates the latency and returns the injected error of the method.
+func (c *Client) call(ctx context.Context, method string) error {
+	c.mutex.Lock()
+	latency := c.latency
+	err := c.errors[method]
+	c.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// FloatingIPs satisfies cloud.Client interface.
+func (c *Client) FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error) {
+	if err := c.call(ctx, MethodFloatingIPs); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fips := make([]*hcloud.FloatingIP, len(c.floatingIPs))
+	for i, fip := range c.floatingIPs {
+		fips[i] = copyFloatingIP(fip)
+	}
+	return fips, nil
+}
+
+// CreateFloatingIP satisfies cloud.Client interface. The created floating
+// ips get addresses out of documentation ranges.
+func (c *Client) CreateFloatingIP(ctx context.Context, opts hcloud.FloatingIPCreateOpts) (*hcloud.FloatingIP, error) {
+	if err := c.call(ctx, MethodCreateFloatingIP); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	id := c.lastID + 1
+	for _, f := range c.floatingIPs {
+		if f.ID >= id {
+			id = f.ID + 1
+		}
+	}
+	c.lastID = id
+
+	fip := &hcloud.FloatingIP{
+		ID:           id,
+		Type:         opts.Type,
+		HomeLocation: opts.HomeLocation,
+		Labels:       opts.Labels,
+	}
+	if opts.Description != nil {
+		fip.Description = *opts.Description
+	}
+	if opts.Type == hcloud.FloatingIPTypeIPv6 {
+		fip.IP = net.ParseIP(fmt.Sprintf("2001:db8:%x::", id))
+	} else {
+		fip.IP = net.IPv4(192, 0, 2, byte(id))
+	}
+	c.floatingIPs = append(c.floatingIPs, fip)
+
+	return copyFloatingIP(fip), nil
+}
+
+// DeleteFloatingIP satisfies cloud.Client interface.
+func (c *Client) DeleteFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) error {
+	if err := c.call(ctx, MethodDeleteFloatingIP); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, f := range c.floatingIPs {
+		if f.ID == fip.ID {
+			c.floatingIPs = append(c.floatingIPs[:i], c.floatingIPs[i+1:]...)
+			return nil
+		}
+	}
+	return hcloud.Error{Code: hcloud.ErrorCodeNotFound, Message: "floating ip not found"}
+}
+
+// AssignFloatingIP satisfies cloud.Client interface.
+func (c *Client) AssignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP, server *hcloud.Server) (*hcloud.Action, error) {
+	if err := c.call(ctx, MethodAssignFloatingIP); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, f := range c.floatingIPs {
+		if f.ID != fip.ID {
+			continue
+		}
+
+		// Like the API the assigned server only contains the ID.
+		f.Server = &hcloud.Server{ID: server.ID}
+		c.assignments = append(c.assignments, Assignment{FloatingIPID: fip.ID, ServerID: server.ID})
+		return c.startAction("assign_floating_ip"), nil
+	}
+
+	return nil, hcloud.Error{Code: hcloud.ErrorCodeNotFound, Message: "floating ip not found"}
+}
+
+// UnassignFloatingIP satisfies cloud.Client interface.
+func (c *Client) UnassignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) (*hcloud.Action, error) {
+	if err := c.call(ctx, MethodUnassignFloatingIP); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, f := range c.floatingIPs {
+		if f.ID != fip.ID {
+			continue
+		}
+
+		f.Server = nil
+		c.assignments = append(c.assignments, Assignment{FloatingIPID: fip.ID})
+		return c.startAction("unassign_floating_ip"), nil
+	}
+
+	return nil, hcloud.Error{Code: hcloud.ErrorCodeNotFound, Message: "floating ip not found"}
+}
+
+// Action satisfies cloud.Client interface.
+func (c *Client) Action(ctx context.Context, id int) (*hcloud.Action, error) {
+	if err := c.call(ctx, MethodAction); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	action, ok := c.actions[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *action
+	return &copied, nil
+}
+
+// startAction records a new action with the configured status, the mutex
+// has to be held.
+func (c *Client) startAction(command string) *hcloud.Action {
+	c.actionID++
+	action := &hcloud.Action{
+		ID:      c.actionID,
+		Command: command,
+		Status:  c.newStatus,
+	}
+	switch c.newStatus {
+	case hcloud.ActionStatusSuccess:
+		action.Progress = 100
+	case hcloud.ActionStatusError:
+		action.ErrorCode = "action_failed"
+		action.ErrorMessage = "action failed"
+	}
+	c.actions[action.ID] = action
+
+	copied := *action
+	return &copied
+}
+
+// ServerByID satisfies cloud.Client interface.
+func (c *Client) ServerByID(ctx context.Context, id int) (*hcloud.Server, error) {
+	if err := c.call(ctx, MethodServerByID); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, server := range c.servers {
+		if server.ID == id {
+			s := *server
+			return &s, nil
+		}
+	}
+	return nil, nil
+}
+
+// ServerByName satisfies cloud.Client interface.
+func (c *Client) ServerByName(ctx context.Context, name string) (*hcloud.Server, error) {
+	if err := c.call(ctx, MethodServerByName); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, server := range c.servers {
+		if server.Name == name {
+			s := *server
+			return &s, nil
+		}
+	}
+	return nil, nil
+}
+
+func copyFloatingIP(fip *hcloud.FloatingIP) *hcloud.FloatingIP {
+	f := *fip
+	if fip.Server != nil {
+		f.Server = &hcloud.Server{ID: fip.Server.ID}
+	}
+	return &f
+}
@@ -0,0 +1,93 @@
+package cloud
+
+import (
+	"context"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/metrics"
+)
+
+// instrumented is a Client that records metrics of every call.
+type instrumented struct {
+	cli     Client
+	metrics metrics.Recorder
+}
+
+// NewInstrumented returns a client that records the calls to the wrapped
+// client on the metrics recorder.
+func NewInstrumented(cli Client, metricsRec metrics.Recorder) Client {
+	return &instrumented{
+		cli:     cli,
+		metrics: metricsRec,
+	}
+}
+
+func (i *instrumented) observe(endpoint string, start time.Time, err error) {
+	i.metrics.ObserveHCloudRequest(endpoint, err, time.Since(start))
+}
+
+// FloatingIPs satisfies Client interface.
+func (i *instrumented) FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error) {
+	start := time.Now()
+	fips, err := i.cli.FloatingIPs(ctx)
+	i.observe("floating_ip_all", start, err)
+	return fips, err
+}
+
+// CreateFloatingIP satisfies Client interface.
+func (i *instrumented) CreateFloatingIP(ctx context.Context, opts hcloud.FloatingIPCreateOpts) (*hcloud.FloatingIP, error) {
+	start := time.Now()
+	fip, err := i.cli.CreateFloatingIP(ctx, opts)
+	i.observe("floating_ip_create", start, err)
+	return fip, err
+}
+
+// DeleteFloatingIP satisfies Client interface.
+func (i *instrumented) DeleteFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) error {
+	start := time.Now()
+	err := i.cli.DeleteFloatingIP(ctx, fip)
+	i.observe("floating_ip_delete", start, err)
+	return err
+}
+
+// AssignFloatingIP satisfies Client interface.
+func (i *instrumented) AssignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP, server *hcloud.Server) (*hcloud.Action, error) {
+	start := time.Now()
+	action, err := i.cli.AssignFloatingIP(ctx, fip, server)
+	i.observe("floating_ip_assign", start, err)
+	return action, err
+}
+
+// UnassignFloatingIP satisfies Client interface.
+func (i *instrumented) UnassignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) (*hcloud.Action, error) {
+	start := time.Now()
+	action, err := i.cli.UnassignFloatingIP(ctx, fip)
+	i.observe("floating_ip_unassign", start, err)
+	return action, err
+}
+
+// Action satisfies Client interface.
+func (i *instrumented) Action(ctx context.Context, id int) (*hcloud.Action, error) {
+	start := time.Now()
+	action, err := i.cli.Action(ctx, id)
+	i.observe("action_get_by_id", start, err)
+	return action, err
+}
+
+// ServerByID satisfies Client interface.
+func (i *instrumented) ServerByID(ctx context.Context, id int) (*hcloud.Server, error) {
+	start := time.Now()
+	server, err := i.cli.ServerByID(ctx, id)
+	i.observe("server_get_by_id", start, err)
+	return server, err
+}
+
+// ServerByName satisfies Client interface.
+func (i *instrumented) ServerByName(ctx context.Context, name string) (*hcloud.Server, error) {
+	start := time.Now()
+	server, err := i.cli.ServerByName(ctx, name)
+	i.observe("server_get_by_name", start, err)
+	return server, err
+}
@@ -0,0 +1,46 @@
+package cloud
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+)
+
+const (
+	// rateLimitResetHeader is the header of hcloud api responses that holds
+	// the unix time the rate limit is reset.
+	rateLimitResetHeader = "RateLimit-Reset"
+)
+
+// RateLimitError is returned if the hcloud api rejected a request because
+// the rate limit was exceeded.
+type RateLimitError struct {
+	// Reset is the time the rate limit is reset, zero if it is unknown.
+	Reset time.Time
+	Err   error
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Reset.IsZero() {
+		return fmt.Sprintf("rate limit exceeded: %s", e.Err)
+	}
+	return fmt.Sprintf("rate limit exceeded until %s: %s", e.Reset.Format(time.RFC3339), e.Err)
+}
+
+// rateLimitError wraps errors of exceeded rate limits into a RateLimitError
+// with the reset time of the response if it is available.
+func rateLimitError(resp *hcloud.Response, err error) error {
+	if err == nil || !hcloud.IsError(err, hcloud.ErrorCodeRateLimitExceeded) {
+		return err
+	}
+
+	rerr := &RateLimitError{Err: err}
+	if resp != nil && resp.Response != nil {
+		if reset, perr := strconv.ParseInt(resp.Header.Get(rateLimitResetHeader), 10, 64); perr == nil {
+			rerr.Reset = time.Unix(reset, 0)
+		}
+	}
+	return rerr
+}
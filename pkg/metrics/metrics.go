@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Recorder knows how to record metrics of the operator.
+type Recorder interface {
+	// IncReassignments increments the number of times a floating ip has been
+	// assigned to a new node.
+	IncReassignments(floatingIP string)
+	// IncReconcileErrors increments the number of failed reconcilations of a
+	// floating ip by reason.
+	IncReconcileErrors(floatingIP, reason string)
+	// ObserveReconcileDuration observes the duration of a single reconcilation.
+	ObserveReconcileDuration(floatingIP string, duration time.Duration)
+	// SetLastSuccessfulReconcile sets the time of the last reconcilation that
+	// finished without error.
+	SetLastSuccessfulReconcile(floatingIP string, t time.Time)
+	// SetAssignedNodes sets the nodes the addresses of a floating ip are
+	// currently assigned to, keyed by address.
+	SetAssignedNodes(floatingIP string, nodes map[string]string)
+	// DeleteFloatingIP removes all metrics of a floating ip.
+	DeleteFloatingIP(floatingIP string)
+	// ObserveHCloudRequest observes a single call to the hcloud api.
+	ObserveHCloudRequest(endpoint string, err error, duration time.Duration)
+}
+
+// Dummy is a recorder that doesn't record anything.
+var Dummy = &dummy{}
+
+type dummy struct{}
+
+func (d *dummy) IncReassignments(floatingIP string)                                      {}
+func (d *dummy) IncReconcileErrors(floatingIP, reason string)                            {}
+func (d *dummy) ObserveReconcileDuration(floatingIP string, duration time.Duration)      {}
+func (d *dummy) SetLastSuccessfulReconcile(floatingIP string, t time.Time)               {}
+func (d *dummy) SetAssignedNodes(floatingIP string, nodes map[string]string)             {}
+func (d *dummy) DeleteFloatingIP(floatingIP string)                                      {}
+func (d *dummy) ObserveHCloudRequest(endpoint string, err error, duration time.Duration) {}
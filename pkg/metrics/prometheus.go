@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	promNamespace = "hcloud_floating_ip_operator"
+
+	successLabel = "success"
+	errorLabel   = "error"
+)
+
+// Prometheus is a recorder that exposes the metrics in prometheus format.
+type Prometheus struct {
+	reassignments      *prometheus.CounterVec
+	reconcileErrors    *prometheus.CounterVec
+	reconcileDuration  *prometheus.HistogramVec
+	lastReconcile      *prometheus.GaugeVec
+	assignedNode       *prometheus.GaugeVec
+	hcloudRequests     *prometheus.CounterVec
+	hcloudRequestsTime *prometheus.HistogramVec
+
+	// nodes keeps track of the assigned node per address of every floating
+	// ip so the previous series can be removed when an address moves.
+	nodes map[string]map[string]string
+	// reasons keeps track of the reconcile error reasons per floating ip so
+	// their series can be removed with the floating ip.
+	reasons map[string]map[string]bool
+	mutex   sync.Mutex
+}
+
+// NewPrometheus returns a new prometheus recorder that registers its
+// metrics on the given registerer.
+func NewPrometheus(reg prometheus.Registerer) *Prometheus {
+	p := &Prometheus{
+		reassignments: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: promNamespace,
+			Name:      "reassignments_total",
+			Help:      "Number of times the floating ip was assigned to a new node.",
+		}, []string{"floating_ip"}),
+		reconcileErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: promNamespace,
+			Name:      "reconcile_errors_total",
+			Help:      "Number of failed reconcilations of the floating ip by reason.",
+		}, []string{"floating_ip", "reason"}),
+		reconcileDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: promNamespace,
+			Name:      "reconcile_duration_seconds",
+			Help:      "Duration of the reconcilations of the floating ip.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"floating_ip"}),
+		lastReconcile: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: promNamespace,
+			Name:      "last_successful_reconcile_timestamp_seconds",
+			Help:      "Unix timestamp of the last successful reconcilation of the floating ip.",
+		}, []string{"floating_ip"}),
+		assignedNode: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: promNamespace,
+			Name:      "assigned_node",
+			Help:      "Node an address of the floating ip is currently assigned to, the value is always 1.",
+		}, []string{"floating_ip", "ip", "node"}),
+		hcloudRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: promNamespace,
+			Name:      "hcloud_requests_total",
+			Help:      "Number of requests to the hcloud api by endpoint and result.",
+		}, []string{"endpoint", "result"}),
+		hcloudRequestsTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: promNamespace,
+			Name:      "hcloud_request_duration_seconds",
+			Help:      "Latency of the requests to the hcloud api by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+
+		nodes:   map[string]map[string]string{},
+		reasons: map[string]map[string]bool{},
+	}
+
+	reg.MustRegister(
+		p.reassignments,
+		p.reconcileErrors,
+		p.reconcileDuration,
+		p.lastReconcile,
+		p.assignedNode,
+		p.hcloudRequests,
+		p.hcloudRequestsTime,
+	)
+
+	return p
+}
+
+// IncReassignments satisfies Recorder interface.
+func (p *Prometheus) IncReassignments(floatingIP string) {
+	p.reassignments.WithLabelValues(floatingIP).Inc()
+}
+
+// IncReconcileErrors satisfies Recorder interface.
+func (p *Prometheus) IncReconcileErrors(floatingIP, reason string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.reasons[floatingIP] == nil {
+		p.reasons[floatingIP] = map[string]bool{}
+	}
+	p.reasons[floatingIP][reason] = true
+	p.reconcileErrors.WithLabelValues(floatingIP, reason).Inc()
+}
+
+// ObserveReconcileDuration satisfies Recorder interface.
+func (p *Prometheus) ObserveReconcileDuration(floatingIP string, duration time.Duration) {
+	p.reconcileDuration.WithLabelValues(floatingIP).Observe(duration.Seconds())
+}
+
+// SetLastSuccessfulReconcile satisfies Recorder interface.
+func (p *Prometheus) SetLastSuccessfulReconcile(floatingIP string, t time.Time) {
+	p.lastReconcile.WithLabelValues(floatingIP).Set(float64(t.Unix()))
+}
+
+// SetAssignedNodes satisfies Recorder interface. Addresses without a node
+// have no series.
+func (p *Prometheus) SetAssignedNodes(floatingIP string, nodes map[string]string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for ip, prev := range p.nodes[floatingIP] {
+		if nodes[ip] != prev {
+			p.assignedNode.DeleteLabelValues(floatingIP, ip, prev)
+		}
+	}
+
+	current := map[string]string{}
+	for ip, node := range nodes {
+		if node == "" {
+			continue
+		}
+		current[ip] = node
+		p.assignedNode.WithLabelValues(floatingIP, ip, node).Set(1)
+	}
+	p.nodes[floatingIP] = current
+}
+
+// DeleteFloatingIP satisfies Recorder interface.
+func (p *Prometheus) DeleteFloatingIP(floatingIP string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for ip, node := range p.nodes[floatingIP] {
+		p.assignedNode.DeleteLabelValues(floatingIP, ip, node)
+	}
+	delete(p.nodes, floatingIP)
+	for reason := range p.reasons[floatingIP] {
+		p.reconcileErrors.DeleteLabelValues(floatingIP, reason)
+	}
+	delete(p.reasons, floatingIP)
+	p.reassignments.DeleteLabelValues(floatingIP)
+	p.reconcileDuration.DeleteLabelValues(floatingIP)
+	p.lastReconcile.DeleteLabelValues(floatingIP)
+}
+
+// ObserveHCloudRequest satisfies Recorder interface.
+func (p *Prometheus) ObserveHCloudRequest(endpoint string, err error, duration time.Duration) {
+	result := successLabel
+	if err != nil {
+		result = errorLabel
+	}
+	p.hcloudRequests.WithLabelValues(endpoint, result).Inc()
+	p.hcloudRequestsTime.WithLabelValues(endpoint).Observe(duration.Seconds())
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// series returns the number of series per metric with the floating ip label.
+func series(t *testing.T, reg *prometheus.Registry, floatingIP string) map[string]int {
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]int{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "floating_ip" && label.GetValue() == floatingIP {
+					got[family.GetName()]++
+				}
+			}
+		}
+	}
+	return got
+}
+
+func TestPrometheusSetAssignedNodes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := NewPrometheus(reg)
+
+	p.SetAssignedNodes("test", map[string]string{"192.0.2.10": "node1", "192.0.2.11": "node2", "192.0.2.12": ""})
+	if got := series(t, reg, "test")[promNamespace+"_assigned_node"]; got != 2 {
+		t.Errorf("expected a series per assigned address, got %d", got)
+	}
+
+	p.SetAssignedNodes("test", map[string]string{"192.0.2.10": "node2"})
+	if got := series(t, reg, "test")[promNamespace+"_assigned_node"]; got != 1 {
+		t.Errorf("expected the series of moved and removed addresses to be deleted, got %d", got)
+	}
+}
+
+func TestPrometheusDeleteFloatingIP(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := NewPrometheus(reg)
+
+	for _, floatingIP := range []string{"test", "other"} {
+		p.IncReassignments(floatingIP)
+		p.IncReconcileErrors(floatingIP, "NoEligibleNodes")
+		p.IncReconcileErrors(floatingIP, "FloatingIPNotFound")
+		p.ObserveReconcileDuration(floatingIP, time.Second)
+		p.SetLastSuccessfulReconcile(floatingIP, time.Now())
+		p.SetAssignedNodes(floatingIP, map[string]string{"192.0.2.10": "node1"})
+	}
+	p.ObserveHCloudRequest("floating_ips", errors.New("failed"), time.Second)
+
+	p.DeleteFloatingIP("test")
+
+	if got := series(t, reg, "test"); len(got) != 0 {
+		t.Errorf("expected no series of the deleted floating ip, got %v", got)
+	}
+	if got := series(t, reg, "other")[promNamespace+"_reconcile_errors_total"]; got != 2 {
+		t.Errorf("expected the series of other floating ips to be kept, got %d", got)
+	}
+}
@@ -8,4 +8,19 @@ import (
 type Config struct {
 	// ResyncPeriod is the resync period of the operator.
 	ResyncPeriod time.Duration
+
+	// ServerIDKey is the node label or annotation that holds the hcloud
+	// server id of nodes without a hcloud provider id.
+	ServerIDKey string
+
+	// HCloudCacheTTL is how long reads from the hcloud api are shared
+	// between the floating ips.
+	HCloudCacheTTL time.Duration
+
+	// RequireAgent only reports floating ips as ready once the node agent
+	// configured them.
+	RequireAgent bool
+
+	// Namespace is the namespace the operator runs in.
+	Namespace string
 }
@@ -35,6 +35,8 @@ func (p *floatingIPCRD) Initialize() error {
 		Group:      hcloudv1alpha1.SchemeGroupVersion.Group,
 		Version:    hcloudv1alpha1.SchemeGroupVersion.Version,
 		Scope:      hcloudv1alpha1.FloatingIPScope,
+
+		EnableStatusSubresource: true,
 	}
 
 	return p.crdCli.EnsurePresent(crd)
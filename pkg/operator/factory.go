@@ -1,28 +1,86 @@
 package operator
 
 import (
-	"github.com/hetznercloud/hcloud-go/hcloud"
 	"github.com/spotahome/kooper/client/crd"
 	"github.com/spotahome/kooper/operator"
 	"github.com/spotahome/kooper/operator/controller"
 	"k8s.io/client-go/kubernetes"
 
 	floatingipk8scli "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
 	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/metrics"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/service"
 )
 
 // New returns floating ip operator.
-func New(cfg Config, floatingIPClie floatingipk8scli.Interface, crdCli crd.Interface, kubeCli kubernetes.Interface, hcloudCli *hcloud.Client, logger log.Logger) (operator.Operator, error) {
+func New(cfg Config, floatingIPClie floatingipk8scli.Interface, crdCli crd.Interface, kubeCli kubernetes.Interface, cloudCli cloud.Client, metricsRec metrics.Recorder, logger log.Logger) (operator.Operator, error) {
 
 	// Create crd.
 	ptCRD := newFloatingIPCRD(floatingIPClie, crdCli, kubeCli)
 
+	// Create event recorder.
+	recorder := newEventRecorder(kubeCli, logger)
+
+	// Create service.
+	svcCfg := service.Config{
+		ServerIDKey:  cfg.ServerIDKey,
+		CacheTTL:     cfg.HCloudCacheTTL,
+		RequireAgent: cfg.RequireAgent,
+		Namespace:    cfg.Namespace,
+	}
+	svc := service.NewService(svcCfg, kubeCli, floatingIPClie, cloudCli, recorder, metricsRec, logger)
+
 	// Create handler.
-	handler := newHandler(kubeCli, hcloudCli, logger)
+	handler := newHandler(svc, logger)
 
 	// Create controller.
 	ctrl := controller.NewSequential(cfg.ResyncPeriod, handler, ptCRD, nil, logger)
 
+	// Create the controller for services of type LoadBalancer.
+	svcHandler := newServiceHandler(kubeCli, floatingIPClie, logger)
+	svcCtrl := controller.NewSequential(cfg.ResyncPeriod, svcHandler, newServiceRetriever(kubeCli), nil, logger)
+
 	// Assemble CRD and controller to create the operator.
-	return operator.NewOperator(ptCRD, ctrl, logger), nil
+	return &floatingIPOperator{
+		Operator:          operator.NewOperator(ptCRD, ctrl, logger),
+		service:           svc,
+		serviceHandler:    svcHandler,
+		serviceController: svcCtrl,
+		logger:            logger,
+	}, nil
+}
+
+// floatingIPOperator is the kooper operator that additionally runs the
+// informers of the service and the controller for kubernetes services.
+type floatingIPOperator struct {
+	operator.Operator
+	service           *service.Service
+	serviceHandler    *serviceHandler
+	serviceController controller.Controller
+	logger            log.Logger
+}
+
+// Run will start the service informers and the service controller before
+// running the operator.
+func (o *floatingIPOperator) Run(stopC <-chan struct{}) error {
+	if err := o.service.Run(stopC); err != nil {
+		return err
+	}
+
+	// The service controller creates floating ips, so the CRD needs to be
+	// present before it starts.
+	if err := o.Operator.Initialize(); err != nil {
+		return err
+	}
+	if err := o.serviceHandler.Run(stopC); err != nil {
+		return err
+	}
+	go func() {
+		if err := o.serviceController.Run(stopC); err != nil {
+			o.logger.Errorf("error running service controller: %s", err)
+		}
+	}()
+
+	return o.Operator.Run(stopC)
 }
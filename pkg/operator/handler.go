@@ -3,9 +3,7 @@ package operator
 import (
 	"fmt"
 
-	"github.com/hetznercloud/hcloud-go/hcloud"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
 
 	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
 	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
@@ -20,9 +18,9 @@ type handler struct {
 }
 
 // newHandler returns a new handler.
-func newHandler(k8sCli kubernetes.Interface, hcloudCli *hcloud.Client, logger log.Logger) *handler {
+func newHandler(svc service.Syncer, logger log.Logger) *handler {
 	return &handler{
-		service: service.NewService(k8sCli, hcloudCli, logger),
+		service: svc,
 		logger:  logger,
 	}
 }
@@ -0,0 +1,32 @@
+package operator
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	floatingipscheme "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned/scheme"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
+)
+
+const (
+	// eventComponent is the source component of the events emitted by the operator.
+	eventComponent = "hcloud-floating-ip-operator"
+)
+
+// newEventRecorder returns an event recorder that will write events for
+// floating ips and core kubernetes objects to the cluster.
+func newEventRecorder(kubeCli kubernetes.Interface, logger log.Logger) record.EventRecorder {
+	scheme := runtime.NewScheme()
+	kubescheme.AddToScheme(scheme)
+	floatingipscheme.AddToScheme(scheme)
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(logger.Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeCli.CoreV1().Events("")})
+
+	return broadcaster.NewRecorder(scheme, corev1.EventSource{Component: eventComponent})
+}
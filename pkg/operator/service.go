@@ -0,0 +1,38 @@
+package operator
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// serviceRetriever retrieves the kubernetes services.
+type serviceRetriever struct {
+	kubeCli kubernetes.Interface
+}
+
+func newServiceRetriever(kubeCli kubernetes.Interface) *serviceRetriever {
+	return &serviceRetriever{
+		kubeCli: kubeCli,
+	}
+}
+
+// GetListerWatcher satisfies retrieve.Retriever interface.
+func (r *serviceRetriever) GetListerWatcher() cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return r.kubeCli.CoreV1().Services(metav1.NamespaceAll).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return r.kubeCli.CoreV1().Services(metav1.NamespaceAll).Watch(options)
+		},
+	}
+}
+
+// GetObject satisfies retrieve.Retriever interface.
+func (r *serviceRetriever) GetObject() runtime.Object {
+	return &corev1.Service{}
+}
@@ -0,0 +1,299 @@
+package operator
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/apricote/hcloud-floating-ip-operator/apis/hcloud"
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	floatingipk8scli "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
+)
+
+const (
+	// floatingIPAnnotation is the annotation on services of type
+	// LoadBalancer that holds the floating ip of the service.
+	floatingIPAnnotation = hcloud.GroupName + "/floating-ip"
+
+	// Labels of the floating ips created for services.
+	serviceNamespaceLabel = hcloud.GroupName + "/service-namespace"
+	serviceNameLabel      = hcloud.GroupName + "/service-name"
+
+	// serviceIndex indexes the floating ips by the key of the service they
+	// were created for.
+	serviceIndex = "service"
+)
+
+// serviceHandler manages a floating ip resource for every service of type
+// LoadBalancer with the floating ip annotation.
+type serviceHandler struct {
+	kubeCli       kubernetes.Interface
+	floatingIPCli floatingipk8scli.Interface
+	logger        log.Logger
+	informer      cache.SharedIndexInformer
+}
+
+// newServiceHandler returns a new service handler.
+func newServiceHandler(kubeCli kubernetes.Interface, floatingIPCli floatingipk8scli.Interface, logger log.Logger) *serviceHandler {
+	h := &serviceHandler{
+		kubeCli:       kubeCli,
+		floatingIPCli: floatingIPCli,
+		logger:        logger,
+	}
+
+	h.informer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return floatingIPCli.HcloudV1alpha1().FloatingIPs().List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return floatingIPCli.HcloudV1alpha1().FloatingIPs().Watch(options)
+			},
+		},
+		&hcloudv1alpha1.FloatingIP{},
+		0,
+		cache.Indexers{serviceIndex: serviceIndexFunc},
+	)
+
+	return h
+}
+
+// Run starts the informer of the floating ips and waits until it is
+// synced.
+func (h *serviceHandler) Run(stopC <-chan struct{}) error {
+	go h.informer.Run(stopC)
+
+	if !cache.WaitForCacheSync(stopC, h.informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for informers to sync")
+	}
+	return nil
+}
+
+// Add will ensure the floating ip of the service exists and is written to
+// the load balancer status of the service.
+func (h *serviceHandler) Add(obj runtime.Object) error {
+	svc, ok := obj.(*corev1.Service)
+	if !ok {
+		return fmt.Errorf("%v is not a service object", obj.GetObjectKind())
+	}
+
+	value, ok := svc.Annotations[floatingIPAnnotation]
+	if !ok || svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		// Most services never had a floating ip, they are done without
+		// any api call.
+		ips, err := h.deleteFloatingIPs(svc.Namespace, svc.Name)
+		if err != nil || len(ips) == 0 {
+			return err
+		}
+		return h.removeIngress(svc, ips)
+	}
+
+	ip, err := serviceIP(value)
+	if err != nil {
+		return fmt.Errorf("annotation %s of service %s/%s: %s", floatingIPAnnotation, svc.Namespace, svc.Name, err)
+	}
+
+	if len(svc.Spec.Selector) == 0 {
+		return fmt.Errorf("service %s/%s has no selector, floating ips are only supported for services with endpoints selected by pods", svc.Namespace, svc.Name)
+	}
+
+	if err := h.ensureFloatingIP(svc, ip); err != nil {
+		return err
+	}
+
+	return h.ensureIngress(svc, ip)
+}
+
+// Delete will remove the floating ip of the service.
+func (h *serviceHandler) Delete(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.deleteFloatingIPs(namespace, name)
+	return err
+}
+
+// ensureFloatingIP will create or update the floating ip resource that
+// assigns the ip to a node running a ready endpoint of the service.
+func (h *serviceHandler) ensureFloatingIP(svc *corev1.Service, ip string) error {
+	spec := hcloudv1alpha1.FloatinIPSpec{
+		IP:           ip,
+		NodeSelector: map[string]string{},
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: svc.Spec.Selector,
+		},
+		PodNamespace: svc.Namespace,
+	}
+
+	fips := h.floatingIPCli.HcloudV1alpha1().FloatingIPs()
+	owned, err := h.serviceFloatingIPs(svc.Namespace, svc.Name)
+	if err != nil {
+		return err
+	}
+	if len(owned) == 0 {
+		name := serviceFloatingIPName(svc.Namespace, svc.Name)
+		h.logger.Infof("creating floating ip %s for service %s/%s", name, svc.Namespace, svc.Name)
+		_, err = fips.Create(&hcloudv1alpha1.FloatingIP{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					serviceNamespaceLabel: svc.Namespace,
+					serviceNameLabel:      svc.Name,
+				},
+			},
+			Spec: spec,
+		})
+		return err
+	}
+
+	if reflect.DeepEqual(owned[0].Spec, spec) {
+		return nil
+	}
+
+	// The floating ip is shared with the informer.
+	fip := owned[0].DeepCopy()
+	h.logger.Infof("updating floating ip %s for service %s/%s", fip.Name, svc.Namespace, svc.Name)
+	fip.Spec = spec
+	_, err = fips.Update(fip)
+	return err
+}
+
+// ensureIngress will set the floating ip as the only ingress of the load
+// balancer status of the service.
+func (h *serviceHandler) ensureIngress(svc *corev1.Service, ip string) error {
+	ingress := []corev1.LoadBalancerIngress{{IP: ip}}
+	if reflect.DeepEqual(svc.Status.LoadBalancer.Ingress, ingress) {
+		return nil
+	}
+
+	svc = svc.DeepCopy()
+	svc.Status.LoadBalancer.Ingress = ingress
+	_, err := h.kubeCli.CoreV1().Services(svc.Namespace).UpdateStatus(svc)
+	return err
+}
+
+// removeIngress will remove the ips from the load balancer status of the
+// service, ingresses of other load balancers are kept.
+func (h *serviceHandler) removeIngress(svc *corev1.Service, ips []string) error {
+	ingress := []corev1.LoadBalancerIngress{}
+	for _, ing := range svc.Status.LoadBalancer.Ingress {
+		if !containsString(ips, ing.IP) {
+			ingress = append(ingress, ing)
+		}
+	}
+	if len(ingress) == len(svc.Status.LoadBalancer.Ingress) {
+		return nil
+	}
+
+	svc = svc.DeepCopy()
+	svc.Status.LoadBalancer.Ingress = ingress
+	_, err := h.kubeCli.CoreV1().Services(svc.Namespace).UpdateStatus(svc)
+	return err
+}
+
+// deleteFloatingIPs will delete the floating ip resources created for the
+// service and return their ips.
+func (h *serviceHandler) deleteFloatingIPs(namespace, name string) ([]string, error) {
+	owned, err := h.serviceFloatingIPs(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fips := h.floatingIPCli.HcloudV1alpha1().FloatingIPs()
+	ips := []string{}
+	for _, fip := range owned {
+		ips = append(ips, fip.Spec.IP)
+		if fip.DeletionTimestamp != nil {
+			continue
+		}
+
+		h.logger.Infof("deleting floating ip %s", fip.Name)
+		if err := fips.Delete(fip.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return ips, nil
+}
+
+// serviceFloatingIPs returns the floating ip resources created for the
+// service, found by their labels in the informer. They are shared and must
+// not be modified.
+func (h *serviceHandler) serviceFloatingIPs(namespace, name string) ([]*hcloudv1alpha1.FloatingIP, error) {
+	objs, err := h.informer.GetIndexer().ByIndex(serviceIndex, namespace+"/"+name)
+	if err != nil {
+		return nil, err
+	}
+
+	fips := []*hcloudv1alpha1.FloatingIP{}
+	for _, obj := range objs {
+		if fip, ok := obj.(*hcloudv1alpha1.FloatingIP); ok {
+			fips = append(fips, fip)
+		}
+	}
+	return fips, nil
+}
+
+// serviceIndexFunc indexes floating ips created for a service by the key
+// of the service.
+func serviceIndexFunc(obj interface{}) ([]string, error) {
+	fip, ok := obj.(*hcloudv1alpha1.FloatingIP)
+	if !ok {
+		return nil, nil
+	}
+
+	namespace, ok := fip.Labels[serviceNamespaceLabel]
+	if !ok {
+		return nil, nil
+	}
+	name, ok := fip.Labels[serviceNameLabel]
+	if !ok {
+		return nil, nil
+	}
+	return []string{namespace + "/" + name}, nil
+}
+
+// serviceIP parses the ip of the annotation. The agent configures ipv6
+// floating ips as the first address of their /64 network, so only that
+// address can be announced as the ingress of the service.
+func serviceIP(value string) (string, error) {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", fmt.Errorf("no ip address: %q", value)
+	}
+	if ip.To4() != nil {
+		return ip.String(), nil
+	}
+
+	first := ip.Mask(net.CIDRMask(64, 128))
+	first[len(first)-1] = 1
+	if !ip.Equal(first) {
+		return "", fmt.Errorf("ipv6 floating ips are configured as the first address of their /64 network, use %s instead of %s", first, ip)
+	}
+	return ip.String(), nil
+}
+
+// serviceFloatingIPName returns the name of the floating ip resource of a
+// service. Namespaces can't contain dots, so names never collide.
+func serviceFloatingIPName(namespace, name string) string {
+	return fmt.Sprintf("service-%s.%s", namespace, name)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
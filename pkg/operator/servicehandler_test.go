@@ -0,0 +1,38 @@
+package operator
+
+import (
+	"testing"
+)
+
+func TestServiceIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		expIP  string
+		expErr bool
+	}{
+		{name: "IPv4 address", value: "192.0.2.10", expIP: "192.0.2.10"},
+		{name: "IPv6 address is canonicalized", value: "2001:db8:1:0::1", expIP: "2001:db8:1::1"},
+		{name: "IPv6 address other than the first of the network", value: "2001:db8:1::10", expErr: true},
+		{name: "IPv6 network address", value: "2001:db8:1::", expErr: true},
+		{name: "No ip address", value: "example.com", expErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ip, err := serviceIP(test.value)
+			if test.expErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if ip != test.expIP {
+				t.Errorf("expected %s, got %s", test.expIP, ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+)
+
+const (
+	// actionPollInterval is the time between polls of a running action.
+	actionPollInterval = time.Second
+	// actionTimeout is the time an action may run before the reconcile
+	// fails.
+	actionTimeout = time.Minute
+)
+
+// waitForAction polls the action until it finished and returns an error if
+// it failed, did not finish in time or the stop channel was closed. A nil
+// stop channel never stops waiting.
+func (p *IPAssigner) waitForAction(action *hcloud.Action, stopC <-chan struct{}) error {
+	if action == nil {
+		return nil
+	}
+
+	timeout := p.time.After(actionTimeout)
+	for action.Status == hcloud.ActionStatusRunning {
+		select {
+		case <-p.time.After(actionPollInterval):
+		case <-timeout:
+			return newReconcileError(reasonActionTimeout, fmt.Errorf("action %d did not finish within %s", action.ID, actionTimeout))
+		case <-stopC:
+			return newReconcileError(reasonActionRunning, fmt.Errorf("ip assigner stopped while action %d was running", action.ID))
+		}
+
+		current, err := p.cloudCli.Action(context.TODO(), action.ID)
+		if err != nil {
+			return newReconcileError(reasonHCloudAPIError, err)
+		}
+		if current == nil {
+			return newReconcileError(reasonActionFailed, fmt.Errorf("action %d does not exist", action.ID))
+		}
+		action = current
+	}
+
+	if action.Status == hcloud.ActionStatusError {
+		return newReconcileError(reasonActionFailed, fmt.Errorf("action %d failed: %s: %s", action.ID, action.ErrorCode, action.ErrorMessage))
+	}
+	return nil
+}
+
+// checkRunningAction returns an error if the action with the id, the last
+// one started for a floating ip, is still running. An id of 0 means there
+// was no action.
+func (p *IPAssigner) checkRunningAction(id int) error {
+	if id == 0 {
+		return nil
+	}
+
+	action, err := p.cloudCli.Action(context.TODO(), id)
+	if err != nil {
+		return newReconcileError(reasonHCloudAPIError, err)
+	}
+	if action != nil && action.Status == hcloud.ActionStatusRunning {
+		return newReconcileError(reasonActionRunning, fmt.Errorf("action %d of the floating ip is still running", id))
+	}
+	return nil
+}
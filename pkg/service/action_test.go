@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	kooperlog "github.com/spotahome/kooper/log"
+
+	cloudfake "github.com/apricote/hcloud-floating-ip-operator/pkg/cloud/fake"
+)
+
+func TestIPAssignerWaitForAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    hcloud.ActionStatus
+		running   bool
+		unknown   bool
+		apiErr    error
+		stop      bool
+		expReason string
+	}{
+		{
+			name:   "Finished action succeeds",
+			status: hcloud.ActionStatusSuccess,
+		},
+		{
+			name:      "Failed action is an error",
+			status:    hcloud.ActionStatusError,
+			expReason: reasonActionFailed,
+		},
+		{
+			name:    "Running action is polled until it finished",
+			status:  hcloud.ActionStatusSuccess,
+			running: true,
+		},
+		{
+			name:      "Running action is polled until it failed",
+			status:    hcloud.ActionStatusError,
+			running:   true,
+			expReason: reasonActionFailed,
+		},
+		{
+			name:      "Action that keeps running times out",
+			status:    hcloud.ActionStatusRunning,
+			running:   true,
+			expReason: reasonActionTimeout,
+		},
+		{
+			name:      "Unknown action is an error",
+			status:    hcloud.ActionStatusSuccess,
+			running:   true,
+			unknown:   true,
+			expReason: reasonActionFailed,
+		},
+		{
+			name:      "Failed poll is an error",
+			status:    hcloud.ActionStatusSuccess,
+			running:   true,
+			apiErr:    errors.New("connection refused"),
+			expReason: reasonHCloudAPIError,
+		},
+		{
+			name:      "Stopped assigner stops waiting",
+			status:    hcloud.ActionStatusRunning,
+			running:   true,
+			stop:      true,
+			expReason: reasonActionRunning,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hetznerIP := &hcloud.FloatingIP{ID: 10, IP: net.ParseIP("192.0.2.10"), Type: hcloud.FloatingIPTypeIPv4}
+			server := &hcloud.Server{ID: 1, Name: "node1"}
+			cloudCli := cloudfake.NewClient([]*hcloud.FloatingIP{hetznerIP}, []*hcloud.Server{server})
+			cloudCli.SetActionStatus(test.status)
+
+			action, err := cloudCli.AssignFloatingIP(context.TODO(), hetznerIP, server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The fake reports the final status when the action is polled.
+			if test.running {
+				action.Status = hcloud.ActionStatusRunning
+			}
+			if test.unknown {
+				action.ID = 99
+			}
+			cloudCli.SetError(cloudfake.MethodAction, test.apiErr)
+
+			stopC := make(chan struct{})
+			if test.stop {
+				close(stopC)
+			}
+
+			clock := newFakeTime()
+			p := &IPAssigner{cloudCli: cloudCli, time: clock, logger: kooperlog.Dummy}
+			done := make(chan error, 1)
+			go func() { done <- p.waitForAction(action, stopC) }()
+
+			// Advance the clock until the polling returned.
+			var got error
+			for i := 0; ; i++ {
+				if i > 1000 {
+					t.Fatalf("action was still polled after %s", actionTimeout)
+				}
+				select {
+				case got = <-done:
+				case <-time.After(time.Millisecond):
+					clock.advance(actionPollInterval)
+					continue
+				}
+				break
+			}
+
+			if test.expReason == "" {
+				if got != nil {
+					t.Errorf("unexpected error: %s", got)
+				}
+				return
+			}
+			if reason := errorReason(got); reason != test.expReason {
+				t.Errorf("expected reason %s, got %s: %v", test.expReason, reason, got)
+			}
+		})
+	}
+}
+
+func TestIPAssignerCheckRunningAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    hcloud.ActionStatus
+		id        int
+		apiErr    error
+		expReason string
+	}{
+		{
+			name: "No action is not running",
+		},
+		{
+			name:   "Finished action is not running",
+			status: hcloud.ActionStatusSuccess,
+			id:     1,
+		},
+		{
+			name:   "Failed action is not running",
+			status: hcloud.ActionStatusError,
+			id:     1,
+		},
+		{
+			name:   "Unknown action is not running",
+			status: hcloud.ActionStatusRunning,
+			id:     99,
+		},
+		{
+			name:      "Running action is an error",
+			status:    hcloud.ActionStatusRunning,
+			id:        1,
+			expReason: reasonActionRunning,
+		},
+		{
+			name:      "Failed request is an error",
+			status:    hcloud.ActionStatusSuccess,
+			id:        1,
+			apiErr:    errors.New("connection refused"),
+			expReason: reasonHCloudAPIError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hetznerIP := &hcloud.FloatingIP{ID: 10, IP: net.ParseIP("192.0.2.10"), Type: hcloud.FloatingIPTypeIPv4}
+			server := &hcloud.Server{ID: 1, Name: "node1"}
+			cloudCli := cloudfake.NewClient([]*hcloud.FloatingIP{hetznerIP}, []*hcloud.Server{server})
+			cloudCli.SetActionStatus(test.status)
+			if _, err := cloudCli.AssignFloatingIP(context.TODO(), hetznerIP, server); err != nil {
+				t.Fatal(err)
+			}
+			cloudCli.SetError(cloudfake.MethodAction, test.apiErr)
+
+			p := &IPAssigner{cloudCli: cloudCli, time: newFakeTime(), logger: kooperlog.Dummy}
+			err := p.checkRunningAction(test.id)
+
+			if test.expReason == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if reason := errorReason(err); reason != test.expReason {
+				t.Errorf("expected reason %q, got %q: %v", test.expReason, reason, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	hcloudfloatingipoperator "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud"
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+const (
+	// ownerLabel is the hcloud label on floating ips created by the operator
+	// that holds the name of the owning floating ip resource.
+	ownerLabel = hcloudfloatingipoperator.GroupName + "/floating-ip"
+	// ownerUIDLabel holds the uid of the owning floating ip resource, the
+	// name alone is shared by resources in other clusters and recreated
+	// resources.
+	ownerUIDLabel = hcloudfloatingipoperator.GroupName + "/floating-ip-uid"
+)
+
+// findOwnedFloatingIP returns the floating ip created by the operator for
+// the resource, preferring the id recorded in the status. Nil is returned
+// if there is none.
+func (p *IPAssigner) findOwnedFloatingIP(fips []*hcloud.FloatingIP, status *hcloudv1alpha1.FloatingIPStatus) *hcloud.FloatingIP {
+	var owned *hcloud.FloatingIP
+	for _, fip := range fips {
+		if !p.ownsFloatingIP(fip, status) {
+			continue
+		}
+		if fip.ID == status.FloatingIPID {
+			return fip
+		}
+		owned = fip
+	}
+	return owned
+}
+
+// ownsFloatingIP checks if the floating ip was created by the operator for
+// the resource. Floating ips created before they were labeled with the uid
+// are only owned if the status of the resource recorded them.
+func (p *IPAssigner) ownsFloatingIP(fip *hcloud.FloatingIP, status *hcloudv1alpha1.FloatingIPStatus) bool {
+	if fip.Labels[ownerLabel] != p.fip.Name {
+		return false
+	}
+	uid, ok := fip.Labels[ownerUIDLabel]
+	if !ok {
+		return status.FloatingIPID != 0 && fip.ID == status.FloatingIPID
+	}
+	return uid != "" && uid == string(p.fip.UID)
+}
+
+// allocateFloatingIP creates a new floating ip of the type in the home
+// location of the spec that is labeled as owned by the resource.
+func (p *IPAssigner) allocateFloatingIP() (*hcloud.FloatingIP, error) {
+	var fipType hcloud.FloatingIPType
+	switch p.fip.Spec.Type {
+	case hcloudv1alpha1.FloatingIPTypeIPv4:
+		fipType = hcloud.FloatingIPTypeIPv4
+	case hcloudv1alpha1.FloatingIPTypeIPv6:
+		fipType = hcloud.FloatingIPTypeIPv6
+	default:
+		return nil, newReconcileError(reasonInvalidSpec, fmt.Errorf("spec has neither an ip nor a valid type (ipv4, ipv6): %q", p.fip.Spec.Type))
+	}
+
+	if p.fip.Spec.HomeLocation == "" {
+		return nil, newReconcileError(reasonInvalidSpec, fmt.Errorf("spec has neither an ip nor a home location"))
+	}
+
+	description := fmt.Sprintf("managed by hcloud-floating-ip-operator for %s", p.fip.Name)
+	fip, err := p.cloudCli.CreateFloatingIP(context.TODO(), hcloud.FloatingIPCreateOpts{
+		Type:         fipType,
+		HomeLocation: &hcloud.Location{Name: p.fip.Spec.HomeLocation},
+		Description:  &description,
+		Labels: map[string]string{
+			ownerLabel:    p.fip.Name,
+			ownerUIDLabel: string(p.fip.UID),
+		},
+	})
+	if err != nil {
+		return nil, newReconcileError(reasonHCloudAPIError, err)
+	}
+
+	p.logger.Infof("%s ip assigner created floating ip %s", p.fip.Name, fip.IP.String())
+	return fip, nil
+}
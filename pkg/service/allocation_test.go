@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	kooperlog "github.com/spotahome/kooper/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	cloudfake "github.com/apricote/hcloud-floating-ip-operator/pkg/cloud/fake"
+)
+
+func TestIPAssignerFindOwnedFloatingIP(t *testing.T) {
+	owned := func(id int, name, uid string) *hcloud.FloatingIP {
+		labels := map[string]string{ownerLabel: name}
+		if uid != "" {
+			labels[ownerUIDLabel] = uid
+		}
+		return &hcloud.FloatingIP{ID: id, IP: net.IPv4(192, 0, 2, byte(id)), Labels: labels}
+	}
+
+	tests := []struct {
+		name     string
+		fips     []*hcloud.FloatingIP
+		statusID int
+		expID    int
+	}{
+		{
+			name:  "Floating ip with the name and uid is owned",
+			fips:  []*hcloud.FloatingIP{owned(10, "test", "uid-1")},
+			expID: 10,
+		},
+		{
+			name: "Floating ip with the name of another uid is not owned",
+			fips: []*hcloud.FloatingIP{owned(10, "test", "uid-2")},
+		},
+		{
+			name: "Floating ip with the uid of another name is not owned",
+			fips: []*hcloud.FloatingIP{owned(10, "other", "uid-1")},
+		},
+		{
+			name:     "Floating ip without uid recorded in the status is owned",
+			fips:     []*hcloud.FloatingIP{owned(10, "test", "")},
+			statusID: 10,
+			expID:    10,
+		},
+		{
+			name: "Floating ip without uid not recorded in the status is not owned",
+			fips: []*hcloud.FloatingIP{owned(10, "test", "")},
+		},
+		{
+			name:     "Floating ip recorded in the status is preferred",
+			fips:     []*hcloud.FloatingIP{owned(10, "test", "uid-1"), owned(11, "test", "uid-1"), owned(12, "test", "uid-1")},
+			statusID: 11,
+			expID:    11,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fip := &hcloudv1alpha1.FloatingIP{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "uid-1"}}
+			p := &IPAssigner{fip: fip}
+
+			got := p.findOwnedFloatingIP(test.fips, &hcloudv1alpha1.FloatingIPStatus{FloatingIPID: test.statusID})
+
+			if test.expID == 0 {
+				if got != nil {
+					t.Errorf("expected no owned floating ip, got %d", got.ID)
+				}
+				return
+			}
+			if got == nil || got.ID != test.expID {
+				t.Errorf("expected owned floating ip %d, got %v", test.expID, got)
+			}
+		})
+	}
+}
+
+func TestIPAssignerCleanupDeletesOwnedFloatingIPs(t *testing.T) {
+	tests := []struct {
+		name      string
+		labels    map[string]string
+		expDelete bool
+	}{
+		{
+			name:      "Floating ip of the resource is deleted",
+			labels:    map[string]string{ownerLabel: "test", ownerUIDLabel: "uid-1"},
+			expDelete: true,
+		},
+		{
+			name:   "Floating ip of a resource with the same name is kept",
+			labels: map[string]string{ownerLabel: "test", ownerUIDLabel: "uid-2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hetznerIP := &hcloud.FloatingIP{ID: 10, IP: net.ParseIP("192.0.2.10"), Type: hcloud.FloatingIPTypeIPv4, Labels: test.labels}
+			cloudCli := cloudfake.NewClient([]*hcloud.FloatingIP{hetznerIP}, nil)
+
+			fip := &hcloudv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "uid-1"},
+				Spec: hcloudv1alpha1.FloatinIPSpec{
+					Type:           hcloudv1alpha1.FloatingIPTypeIPv4,
+					HomeLocation:   "fsn1",
+					DeletionPolicy: hcloudv1alpha1.DeletionPolicyDelete,
+				},
+				Status: hcloudv1alpha1.FloatingIPStatus{FloatingIPID: 10},
+			}
+			p := &IPAssigner{fip: fip, cloudCli: cloudCli, time: newFakeTime(), logger: kooperlog.Dummy}
+
+			if err := p.Cleanup(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			fips, err := cloudCli.FloatingIPs(context.TODO())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted := len(fips) == 0; deleted != test.expDelete {
+				t.Errorf("expected deleted %t, got %t", test.expDelete, deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
+)
+
+const (
+	// maxBackoff is the upper bound of the backoff after transient errors.
+	maxBackoff = 5 * time.Minute
+)
+
+// permanentReasons are the reasons of errors that can only be resolved by
+// changing the spec.
+var permanentReasons = map[string]bool{
+	reasonInvalidSpec:        true,
+	reasonFloatingIPNotFound: true,
+	reasonAmbiguousReference: true,
+}
+
+// permanentCodes are the hcloud error codes that do not resolve by retrying.
+var permanentCodes = map[hcloud.ErrorCode]bool{
+	hcloud.ErrorCodeForbidden:             true,
+	hcloud.ErrorCodeInvalidInput:          true,
+	hcloud.ErrorCodeUniquenessError:       true,
+	hcloud.ErrorCodeResourceLimitExceeded: true,
+	// Not defined by the pinned hcloud-go, returned for invalid tokens.
+	hcloud.ErrorCode("unauthorized"): true,
+}
+
+// backoffCodes are the hcloud error codes of an api that is unavailable or
+// overloaded, retrying them right away only makes it worse.
+var backoffCodes = map[hcloud.ErrorCode]bool{
+	hcloud.ErrorCodeServiceError:      true,
+	hcloud.ErrorCodeRateLimitExceeded: true,
+	hcloud.ErrorCodeLocked:            true,
+	hcloud.ErrorCodeUnknownError:      true,
+	// Not defined by the pinned hcloud-go.
+	hcloud.ErrorCode("timeout"):     true,
+	hcloud.ErrorCode("maintenance"): true,
+}
+
+// errorClass classifies the error of a reconcile as permanent or
+// transient. Unknown errors are transient.
+func errorClass(err error) hcloudv1alpha1.FailureClass {
+	if rerr, ok := err.(*reconcileError); ok {
+		if permanentReasons[rerr.reason] {
+			return hcloudv1alpha1.FailurePermanent
+		}
+		err = rerr.err
+	}
+
+	if herr, ok := err.(hcloud.Error); ok && permanentCodes[herr.Code] {
+		return hcloudv1alpha1.FailurePermanent
+	}
+	return hcloudv1alpha1.FailureTransient
+}
+
+// needsBackoff checks if the error is a failure of the hcloud or kubernetes
+// api that is retried with a backoff. All other transient errors, like no
+// eligible nodes or a deferred reassignment, are retried at the normal
+// interval so failover is not delayed.
+func needsBackoff(err error) bool {
+	if errorClass(err) == hcloudv1alpha1.FailurePermanent {
+		return false
+	}
+
+	if rerr, ok := err.(*reconcileError); ok {
+		if rerr.reason != reasonHCloudAPIError && rerr.reason != reasonActionTimeout {
+			return false
+		}
+		err = rerr.err
+	}
+
+	if _, ok := err.(*cloud.RateLimitError); ok {
+		return true
+	}
+	if herr, ok := err.(hcloud.Error); ok {
+		return backoffCodes[herr.Code]
+	}
+	// Timeouts and errors of the transport or the kubernetes api.
+	return true
+}
+
+// backoffDuration returns the time to wait before the next reconcile after
+// the number of consecutive transient failures, doubling from the minimal
+// interval up to the maximum backoff.
+func backoffDuration(failures int) time.Duration {
+	backoff := time.Duration(MinimalIntervalSeconds) * time.Second
+	for i := 1; i < failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
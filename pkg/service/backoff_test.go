@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
+)
+
+func TestNeedsBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{
+			name:   "Service errors of the hcloud api back off",
+			err:    newReconcileError(reasonHCloudAPIError, hcloud.Error{Code: hcloud.ErrorCodeServiceError}),
+			expect: true,
+		},
+		{
+			name:   "Locked hcloud resources back off",
+			err:    newReconcileError(reasonHCloudAPIError, hcloud.Error{Code: hcloud.ErrorCodeLocked}),
+			expect: true,
+		},
+		{
+			name:   "Exceeded rate limits back off",
+			err:    newReconcileError(reasonHCloudAPIError, &cloud.RateLimitError{Err: errors.New("wanted error")}),
+			expect: true,
+		},
+		{
+			name:   "Transport errors of the hcloud api back off",
+			err:    newReconcileError(reasonHCloudAPIError, errors.New("wanted error")),
+			expect: true,
+		},
+		{
+			name:   "Timed out actions back off",
+			err:    newReconcileError(reasonActionTimeout, errors.New("wanted error")),
+			expect: true,
+		},
+		{
+			name:   "Errors of the kubernetes api back off",
+			err:    errors.New("wanted error"),
+			expect: true,
+		},
+		{
+			name:   "Missing hcloud resources are retried at the interval",
+			err:    newReconcileError(reasonHCloudAPIError, hcloud.Error{Code: hcloud.ErrorCodeNotFound}),
+			expect: false,
+		},
+		{
+			name:   "No eligible nodes are retried at the interval",
+			err:    newReconcileError(reasonNoEligibleNodes, errors.New("wanted error")),
+			expect: false,
+		},
+		{
+			name:   "Deferred reassignments are retried at the interval",
+			err:    newReconcileError(reasonReassignmentDeferred, errors.New("wanted error")),
+			expect: false,
+		},
+		{
+			name:   "Paused reassignments are retried at the interval",
+			err:    newReconcileError(reasonReassignmentPaused, errors.New("wanted error")),
+			expect: false,
+		},
+		{
+			name:   "Permanent errors never back off",
+			err:    newReconcileError(reasonHCloudAPIError, hcloud.Error{Code: hcloud.ErrorCodeForbidden}),
+			expect: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := needsBackoff(test.err); got != test.expect {
+				t.Errorf("expected backoff %t, got %t", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestBackoffDuration(t *testing.T) {
+	tests := []struct {
+		failures int
+		expect   time.Duration
+	}{
+		{failures: 1, expect: 5 * time.Second},
+		{failures: 2, expect: 10 * time.Second},
+		{failures: 4, expect: 40 * time.Second},
+		{failures: 100, expect: maxBackoff},
+	}
+
+	for _, test := range tests {
+		if got := backoffDuration(test.failures); got != test.expect {
+			t.Errorf("expected %s after %d failures, got %s", test.expect, test.failures, got)
+		}
+	}
+}
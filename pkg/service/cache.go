@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
+)
+
+const (
+	// minRateLimitBackoff and maxRateLimitBackoff bound the backoff after an
+	// exceeded rate limit without a known reset time.
+	minRateLimitBackoff = time.Second
+	maxRateLimitBackoff = time.Minute
+
+	// requestTimeout bounds every request to the hcloud api.
+	requestTimeout = 30 * time.Second
+)
+
+// cachedServer is a server lookup, nil servers are cached as well.
+type cachedServer struct {
+	server  *hcloud.Server
+	fetched time.Time
+}
+
+// fipsCall is a listing of the floating ips in flight, concurrent readers
+// wait for it instead of listing again.
+type fipsCall struct {
+	done chan struct{}
+	fips []*hcloud.FloatingIP
+	err  error
+}
+
+// cachedClient is a cloud client shared by all ip assigners. The floating
+// ips are listed at most once per ttl and servers are looked up at most
+// once per ttl, writes invalidate the floating ips. After an exceeded rate
+// limit no requests are made until the limit is reset, reads are answered
+// from the cache in the meantime. The lock only guards the cache, it is
+// never held during requests.
+type cachedClient struct {
+	cloud.Client
+	ttl  time.Duration
+	time TimeWrapper
+
+	mutex       sync.Mutex
+	fips        []*hcloud.FloatingIP
+	fipsFetched time.Time
+	fipsGen     int
+	fipsCall    *fipsCall
+	serverIDs   map[int]cachedServer
+	serverNames map[string]cachedServer
+
+	blockedUntil time.Time
+	backoff      time.Duration
+	blockErr     error
+}
+
+// newCachedClient returns a client that caches the reads of the wrapped
+// client for the ttl.
+func newCachedClient(cli cloud.Client, ttl time.Duration, time TimeWrapper) *cachedClient {
+	return &cachedClient{
+		Client:      cli,
+		ttl:         ttl,
+		time:        time,
+		serverIDs:   map[int]cachedServer{},
+		serverNames: map[string]cachedServer{},
+	}
+}
+
+// FloatingIPs satisfies cloud.Client interface. The returned floating ips
+// are shared and must not be modified.
+func (c *cachedClient) FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error) {
+	c.mutex.Lock()
+	now := c.time.Now()
+	if c.fips != nil && now.Sub(c.fipsFetched) < c.ttl {
+		defer c.mutex.Unlock()
+		return c.fips, nil
+	}
+	if err := c.blocked(now); err != nil {
+		defer c.mutex.Unlock()
+		if c.fips != nil {
+			return c.fips, nil
+		}
+		return nil, err
+	}
+	if call := c.fipsCall; call != nil {
+		c.mutex.Unlock()
+		<-call.done
+		return call.fips, call.err
+	}
+	call := &fipsCall{done: make(chan struct{})}
+	c.fipsCall = call
+	gen := c.fipsGen
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	fips, err := c.Client.FloatingIPs(ctx)
+
+	c.mutex.Lock()
+	call.err = c.observe(err)
+	if call.err == nil {
+		call.fips = fips
+		// Floating ips listed before a write are not cached.
+		if gen == c.fipsGen {
+			c.fips = fips
+			c.fipsFetched = c.time.Now()
+		}
+	}
+	c.fipsCall = nil
+	c.mutex.Unlock()
+	close(call.done)
+
+	return call.fips, call.err
+}
+
+// ServerByID satisfies cloud.Client interface.
+func (c *cachedClient) ServerByID(ctx context.Context, id int) (*hcloud.Server, error) {
+	c.mutex.Lock()
+	now := c.time.Now()
+	cached, ok := c.serverIDs[id]
+	if ok && now.Sub(cached.fetched) < c.ttl {
+		c.mutex.Unlock()
+		return cached.server, nil
+	}
+	if err := c.blocked(now); err != nil {
+		c.mutex.Unlock()
+		if ok {
+			return cached.server, nil
+		}
+		return nil, err
+	}
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	server, err := c.Client.ServerByID(ctx, id)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.observe(err); err != nil {
+		return nil, err
+	}
+	c.storeServer(id, "", server)
+	return server, nil
+}
+
+// ServerByName satisfies cloud.Client interface.
+func (c *cachedClient) ServerByName(ctx context.Context, name string) (*hcloud.Server, error) {
+	c.mutex.Lock()
+	now := c.time.Now()
+	cached, ok := c.serverNames[name]
+	if ok && now.Sub(cached.fetched) < c.ttl {
+		c.mutex.Unlock()
+		return cached.server, nil
+	}
+	if err := c.blocked(now); err != nil {
+		c.mutex.Unlock()
+		if ok {
+			return cached.server, nil
+		}
+		return nil, err
+	}
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	server, err := c.Client.ServerByName(ctx, name)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.observe(err); err != nil {
+		return nil, err
+	}
+	c.storeServer(0, name, server)
+	return server, nil
+}
+
+// CreateFloatingIP satisfies cloud.Client interface.
+func (c *cachedClient) CreateFloatingIP(ctx context.Context, opts hcloud.FloatingIPCreateOpts) (*hcloud.FloatingIP, error) {
+	var fip *hcloud.FloatingIP
+	err := c.write(ctx, func(ctx context.Context) (err error) {
+		fip, err = c.Client.CreateFloatingIP(ctx, opts)
+		return err
+	})
+	return fip, err
+}
+
+// DeleteFloatingIP satisfies cloud.Client interface.
+func (c *cachedClient) DeleteFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) error {
+	return c.write(ctx, func(ctx context.Context) error {
+		return c.Client.DeleteFloatingIP(ctx, fip)
+	})
+}
+
+// AssignFloatingIP satisfies cloud.Client interface.
+func (c *cachedClient) AssignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP, server *hcloud.Server) (*hcloud.Action, error) {
+	var action *hcloud.Action
+	err := c.write(ctx, func(ctx context.Context) (err error) {
+		action, err = c.Client.AssignFloatingIP(ctx, fip, server)
+		return err
+	})
+	return action, err
+}
+
+// UnassignFloatingIP satisfies cloud.Client interface.
+func (c *cachedClient) UnassignFloatingIP(ctx context.Context, fip *hcloud.FloatingIP) (*hcloud.Action, error) {
+	var action *hcloud.Action
+	err := c.write(ctx, func(ctx context.Context) (err error) {
+		action, err = c.Client.UnassignFloatingIP(ctx, fip)
+		return err
+	})
+	return action, err
+}
+
+// Action satisfies cloud.Client interface. Actions change while they are
+// running, so they are never cached.
+func (c *cachedClient) Action(ctx context.Context, id int) (*hcloud.Action, error) {
+	c.mutex.Lock()
+	err := c.blocked(c.time.Now())
+	c.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	action, err := c.Client.Action(ctx, id)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return action, c.observe(err)
+}
+
+// write runs a request that changes floating ips and invalidates the
+// cached floating ips afterwards.
+func (c *cachedClient) write(ctx context.Context, request func(ctx context.Context) error) error {
+	c.mutex.Lock()
+	err := c.blocked(c.time.Now())
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	err = request(ctx)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.fips = nil
+	c.fipsGen++
+	return c.observe(err)
+}
+
+// storeServer caches the server under its id and name, lookups that found
+// no server are cached under the requested id or name. The lock must be
+// held.
+func (c *cachedClient) storeServer(id int, name string, server *hcloud.Server) {
+	cached := cachedServer{server: server, fetched: c.time.Now()}
+	if server != nil {
+		id, name = server.ID, server.Name
+	}
+	if id != 0 {
+		c.serverIDs[id] = cached
+	}
+	if name != "" {
+		c.serverNames[name] = cached
+	}
+}
+
+// blocked returns the rate limit error while requests are blocked. The
+// lock must be held.
+func (c *cachedClient) blocked(now time.Time) error {
+	if now.Before(c.blockedUntil) {
+		return c.blockErr
+	}
+	return nil
+}
+
+// observe blocks requests if the error is an exceeded rate limit, until the
+// limit is reset or with an exponential backoff if the reset is unknown.
+// The lock must be held.
+func (c *cachedClient) observe(err error) error {
+	rerr, ok := err.(*cloud.RateLimitError)
+	if !ok {
+		if err == nil {
+			c.backoff = 0
+		}
+		return err
+	}
+
+	if !rerr.Reset.IsZero() {
+		c.blockedUntil = rerr.Reset
+	} else {
+		c.backoff *= 2
+		if c.backoff < minRateLimitBackoff {
+			c.backoff = minRateLimitBackoff
+		}
+		if c.backoff > maxRateLimitBackoff {
+			c.backoff = maxRateLimitBackoff
+		}
+		c.blockedUntil = c.time.Now().Add(c.backoff)
+	}
+	c.blockErr = err
+	return err
+}
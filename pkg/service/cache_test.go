@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
+	cloudfake "github.com/apricote/hcloud-floating-ip-operator/pkg/cloud/fake"
+)
+
+// fakeTime is a clock that only moves when it is advanced. After fires once
+// the clock was advanced past the duration.
+type fakeTime struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeTime() *fakeTime {
+	return &fakeTime{now: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeTime) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *fakeTime) After(d time.Duration) <-chan time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+	f.timers = append(f.timers, fakeTimer{at: f.now.Add(d), c: c})
+	return c
+}
+
+func (f *fakeTime) advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.now = f.now.Add(d)
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		if t.at.After(f.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- f.now
+	}
+	f.timers = pending
+}
+
+// countingClient counts the listings of floating ips, which wait for the
+// release channel if it is set.
+type countingClient struct {
+	*cloudfake.Client
+	mutex   sync.Mutex
+	calls   int
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *countingClient) FloatingIPs(ctx context.Context) ([]*hcloud.FloatingIP, error) {
+	c.mutex.Lock()
+	c.calls++
+	c.mutex.Unlock()
+
+	if c.started != nil {
+		select {
+		case c.started <- struct{}{}:
+		default:
+		}
+	}
+	if c.release != nil {
+		<-c.release
+	}
+	return c.Client.FloatingIPs(ctx)
+}
+
+func (c *countingClient) listings() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.calls
+}
+
+func newCountingClient() *countingClient {
+	fips := []*hcloud.FloatingIP{{ID: 10}}
+	servers := []*hcloud.Server{{ID: 1, Name: "node1"}}
+	return &countingClient{Client: cloudfake.NewClient(fips, servers)}
+}
+
+func TestCachedClientFloatingIPs(t *testing.T) {
+	// A rate limit error, with the reset time relative to the clock.
+	type rateLimit struct {
+		reset time.Duration
+	}
+
+	type step struct {
+		advance   time.Duration
+		rateLimit *rateLimit
+		write     bool
+		expErr    bool
+		expCalls  int
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "Listings are cached for the ttl",
+			steps: []step{
+				{expCalls: 1},
+				{advance: 5 * time.Second, expCalls: 1},
+				{advance: 6 * time.Second, expCalls: 2},
+			},
+		},
+		{
+			name: "Writes invalidate the listing",
+			steps: []step{
+				{expCalls: 1},
+				{write: true, expCalls: 2},
+				{expCalls: 2},
+			},
+		},
+		{
+			name: "Rate limits block requests until the reset",
+			steps: []step{
+				{rateLimit: &rateLimit{reset: time.Minute}, expErr: true, expCalls: 1},
+				{advance: 30 * time.Second, expErr: true, expCalls: 1},
+				{advance: 31 * time.Second, expCalls: 2},
+			},
+		},
+		{
+			name: "Rate limits serve the stale listing",
+			steps: []step{
+				{expCalls: 1},
+				{advance: 11 * time.Second, rateLimit: &rateLimit{reset: time.Minute}, expErr: true, expCalls: 2},
+				{advance: time.Second, expCalls: 2},
+			},
+		},
+		{
+			name: "Rate limits without reset back off",
+			steps: []step{
+				{rateLimit: &rateLimit{}, expErr: true, expCalls: 1},
+				{advance: 500 * time.Millisecond, expErr: true, expCalls: 1},
+				{advance: 600 * time.Millisecond, rateLimit: &rateLimit{}, expErr: true, expCalls: 2},
+				{advance: 1500 * time.Millisecond, expErr: true, expCalls: 2},
+				{advance: time.Second, expCalls: 3},
+			},
+		},
+		{
+			name: "Rate limits block writes",
+			steps: []step{
+				{rateLimit: &rateLimit{reset: time.Minute}, expErr: true, expCalls: 1},
+				{write: true, expErr: true, expCalls: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeTime()
+			cli := newCountingClient()
+			c := newCachedClient(cli, 10*time.Second, clock)
+
+			for i, step := range test.steps {
+				clock.advance(step.advance)
+				if step.rateLimit != nil {
+					rerr := &cloud.RateLimitError{Err: errors.New("wanted error")}
+					if step.rateLimit.reset > 0 {
+						rerr.Reset = clock.Now().Add(step.rateLimit.reset)
+					}
+					cli.SetError(cloudfake.MethodFloatingIPs, rerr)
+				} else {
+					cli.SetError(cloudfake.MethodFloatingIPs, nil)
+				}
+
+				var err error
+				if step.write {
+					_, err = c.AssignFloatingIP(context.TODO(), &hcloud.FloatingIP{ID: 10}, &hcloud.Server{ID: 1})
+				}
+				if err == nil {
+					_, err = c.FloatingIPs(context.TODO())
+				}
+
+				if step.expErr && err == nil {
+					t.Errorf("step %d: expected an error", i)
+				}
+				if !step.expErr && err != nil {
+					t.Errorf("step %d: unexpected error: %s", i, err)
+				}
+				if got := cli.listings(); got != step.expCalls {
+					t.Errorf("step %d: expected %d listings, got %d", i, step.expCalls, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedClientSharesListings(t *testing.T) {
+	cli := newCountingClient()
+	cli.started = make(chan struct{}, 1)
+	cli.release = make(chan struct{})
+	// Without a ttl only the listing in flight is shared.
+	c := newCachedClient(cli, 0, newFakeTime())
+
+	var wg sync.WaitGroup
+	results := make([][]*hcloud.FloatingIP, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fips, err := c.FloatingIPs(context.TODO())
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			results[i] = fips
+		}(i)
+	}
+
+	<-cli.started
+	// Give the other readers time to wait for the listing in flight.
+	time.Sleep(50 * time.Millisecond)
+	close(cli.release)
+	wg.Wait()
+
+	if got := cli.listings(); got != 1 {
+		t.Errorf("expected 1 listing, got %d", got)
+	}
+	for i, fips := range results {
+		if len(fips) != 1 || fips[0].ID != 10 {
+			t.Errorf("reader %d: expected floating ip 10, got %v", i, fips)
+		}
+	}
+}
+
+func TestCachedClientDropsListingsOverlappingWrites(t *testing.T) {
+	cli := newCountingClient()
+	cli.started = make(chan struct{}, 1)
+	cli.release = make(chan struct{})
+	c := newCachedClient(cli, time.Hour, newFakeTime())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := c.FloatingIPs(context.TODO()); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}()
+
+	<-cli.started
+	if _, err := c.AssignFloatingIP(context.TODO(), &hcloud.FloatingIP{ID: 10}, &hcloud.Server{ID: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	close(cli.release)
+	<-done
+
+	// The listing may predate the assignment, so it must not be cached.
+	cli.started = nil
+	fips, err := c.FloatingIPs(context.TODO())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := cli.listings(); got != 2 {
+		t.Errorf("expected 2 listings, got %d", got)
+	}
+	if len(fips) != 1 || fips[0].Server == nil || fips[0].Server.ID != 1 {
+		t.Errorf("expected floating ip assigned to server 1, got %v", fips)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+
+	hcloudfloatingipoperator "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud"
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+const (
+	// finalizer is added to all floating ip resources so the deletion policy
+	// can be applied before they are removed.
+	finalizer = hcloudfloatingipoperator.GroupName + "/cleanup"
+)
+
+// Cleanup will remove the pods of exec health checks and apply the deletion
+// policy of the floating ip resource to the hcloud floating ip.
+func (p *IPAssigner) Cleanup() error {
+	if err := p.deleteHealthCheckPods(); err != nil {
+		return err
+	}
+
+	policy := p.fip.Spec.DeletionPolicy
+	if policy == "" || policy == hcloudv1alpha1.DeletionPolicyRetain {
+		return nil
+	}
+
+	p.mutex.Lock()
+	status := p.fip.Status.DeepCopy()
+	p.mutex.Unlock()
+
+	fips, err := p.cloudCli.FloatingIPs(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	if isPool(&p.fip.Spec) {
+		return p.cleanupPool(fips)
+	}
+
+	hetznerIP, err := p.matchFloatingIP(fips, status)
+	if reason := errorReason(err); reason == reasonInvalidSpec || reason == reasonAmbiguousReference {
+		// An invalid spec never matched a floating ip, nothing to clean up.
+		p.logger.Warningf("%s ip assigner skips cleanup: %s", p.fip.Name, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if hetznerIP == nil {
+		return nil
+	}
+
+	// Only floating ips created by the operator for the resource are deleted.
+	if policy == hcloudv1alpha1.DeletionPolicyDelete && isOperatorOwned(&p.fip.Spec) && p.ownsFloatingIP(hetznerIP, status) {
+		if err := p.cloudCli.DeleteFloatingIP(context.TODO(), hetznerIP); err != nil {
+			return err
+		}
+		p.logger.Infof("%s ip assigner deleted floating ip %s", p.fip.Name, hetznerIP.IP.String())
+		return nil
+	}
+
+	return p.unassign(hetznerIP)
+}
+
+// cleanupPool will unassign all floating ips of the pool, they are never
+// created by the operator.
+func (p *IPAssigner) cleanupPool(fips []*hcloud.FloatingIP) error {
+	pool, _, err := matchPoolSpec(fips, &p.fip.Spec)
+	if errorReason(err) == reasonInvalidSpec {
+		p.logger.Warningf("%s ip assigner skips cleanup: %s", p.fip.Name, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, hetznerIP := range pool {
+		if err := p.unassign(hetznerIP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unassign will unassign the floating ip if it is assigned to a server.
+func (p *IPAssigner) unassign(hetznerIP *hcloud.FloatingIP) error {
+	if hetznerIP.Server == nil {
+		return nil
+	}
+
+	action, err := p.cloudCli.UnassignFloatingIP(context.TODO(), hetznerIP)
+	if err != nil {
+		return err
+	}
+	// Cleanup runs after the ip assigner stopped, the action is waited for
+	// regardless.
+	if err := p.waitForAction(action, nil); err != nil {
+		return err
+	}
+	p.logger.Infof("%s ip assigner unassigned floating ip %s", p.fip.Name, hetznerIP.IP.String())
+	return nil
+}
+
+// hasFinalizer checks if the floating ip resource has the finalizer of the
+// operator.
+func hasFinalizer(fip *hcloudv1alpha1.FloatingIP) bool {
+	for _, f := range fip.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFinalizer returns the finalizers without the finalizer of the
+// operator.
+func removeFinalizer(finalizers []string) []string {
+	result := []string{}
+	for _, f := range finalizers {
+		if f != finalizer {
+			result = append(result, f)
+		}
+	}
+	return result
+}
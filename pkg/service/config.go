@@ -0,0 +1,24 @@
+package service
+
+import (
+	"time"
+)
+
+// Config is the configuration of the floating ip service.
+type Config struct {
+	// ServerIDKey is the label or annotation of a node that holds the id of
+	// its hcloud server. It is used if the node has no hcloud provider id.
+	ServerIDKey string
+
+	// CacheTTL is how long floating ips and servers read from the hcloud api
+	// are shared between the ip assigners. Defaults to the minimal interval.
+	CacheTTL time.Duration
+
+	// RequireAgent only reports floating ips as ready once the agent on the
+	// assigned node confirmed it configured them.
+	RequireAgent bool
+
+	// Namespace is the namespace of the operator, the pods of exec health
+	// checks run in it.
+	Namespace string
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"fmt"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/agent"
+)
+
+// agentConfirmed checks if the agents on the assigned nodes reported the
+// floating ips of the status as configured. If not the returned message
+// names the first unconfirmed floating ip.
+func (p *IPAssigner) agentConfirmed(status *hcloudv1alpha1.FloatingIPStatus) (bool, string, error) {
+	assigned := map[string]string{}
+	if len(status.IPs) > 0 {
+		for _, a := range status.IPs {
+			assigned[a.IP] = a.NodeName
+		}
+	} else {
+		assigned[status.IP] = status.NodeName
+	}
+
+	for ip, nodeName := range assigned {
+		if nodeName == "" {
+			continue
+		}
+
+		node, err := p.getNode(nodeName)
+		if err != nil {
+			return false, "", err
+		}
+		if node == nil {
+			return false, fmt.Sprintf("node %s does not exist", nodeName), nil
+		}
+		if !agent.ConfiguredFloatingIPs(node)[ip] {
+			return false, fmt.Sprintf("agent on node %s has not configured %s yet", nodeName, ip), nil
+		}
+	}
+	return true, "", nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+// failbackState tracks since when a more preferred node than the current
+// one is available. It is kept in memory, so the failback delay starts
+// over when the operator restarts.
+type failbackState struct {
+	node  string
+	since time.Time
+}
+
+// failbackTarget returns the more preferred node the floating ip returns
+// to from the current node according to the failback policy, nil if it
+// stays.
+func (p *IPAssigner) failbackTarget(current *corev1.Node, nodes []corev1.Node) *corev1.Node {
+	best := mostPreferred(p.fip, nodes)
+	order := preferredOrder(p.fip)
+	if best == nil || preferenceRank(order, best.Name) >= preferenceRank(order, current.Name) {
+		p.failback = failbackState{}
+		return nil
+	}
+
+	switch p.fip.Spec.Failback {
+	case hcloudv1alpha1.FailbackImmediate:
+		return best
+	case hcloudv1alpha1.FailbackAfterDelay:
+		now := p.time.Now()
+		if p.failback.node != best.Name {
+			p.failback = failbackState{node: best.Name, since: now}
+		}
+		delay := time.Duration(p.fip.Spec.FailbackDelaySeconds) * time.Second
+		if now.Sub(p.failback.since) < delay {
+			return nil
+		}
+		return best
+	default:
+		return nil
+	}
+}
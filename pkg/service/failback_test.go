@@ -0,0 +1,131 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+func TestIPAssignerFailbackTarget(t *testing.T) {
+	type step struct {
+		// after is the time passed since the previous step.
+		after     time.Duration
+		nodes     []string
+		expTarget string
+	}
+
+	tests := []struct {
+		name     string
+		failback hcloudv1alpha1.FailbackPolicy
+		delay    hcloudv1alpha1.Seconds
+		current  string
+		steps    []step
+	}{
+		{
+			name:    "Never failback keeps the current node",
+			current: "node3",
+			steps: []step{
+				{nodes: []string{"node1", "node3"}},
+				{after: time.Hour, nodes: []string{"node1", "node3"}},
+			},
+		},
+		{
+			name:     "Immediate failback moves to the more preferred node",
+			failback: hcloudv1alpha1.FailbackImmediate,
+			current:  "node3",
+			steps: []step{
+				{nodes: []string{"node2", "node3"}, expTarget: "node2"},
+				{nodes: []string{"node1", "node2", "node3"}, expTarget: "node1"},
+			},
+		},
+		{
+			name:     "Immediate failback keeps the most preferred node",
+			failback: hcloudv1alpha1.FailbackImmediate,
+			current:  "node1",
+			steps: []step{
+				{nodes: []string{"node1", "node2", "node3"}},
+			},
+		},
+		{
+			name:     "Immediate failback does not move to a less preferred node",
+			failback: hcloudv1alpha1.FailbackImmediate,
+			current:  "node2",
+			steps: []step{
+				{nodes: []string{"node2", "node3"}},
+			},
+		},
+		{
+			name:     "Delayed failback moves once the node was available for the delay",
+			failback: hcloudv1alpha1.FailbackAfterDelay,
+			delay:    60,
+			current:  "node3",
+			steps: []step{
+				{nodes: []string{"node1", "node3"}},
+				{after: 30 * time.Second, nodes: []string{"node1", "node3"}},
+				{after: 30 * time.Second, nodes: []string{"node1", "node3"}, expTarget: "node1"},
+			},
+		},
+		{
+			name:     "Delayed failback starts over if the node was unavailable",
+			failback: hcloudv1alpha1.FailbackAfterDelay,
+			delay:    60,
+			current:  "node3",
+			steps: []step{
+				{nodes: []string{"node1", "node3"}},
+				{after: 45 * time.Second, nodes: []string{"node3"}},
+				{after: 15 * time.Second, nodes: []string{"node1", "node3"}},
+				{after: 45 * time.Second, nodes: []string{"node1", "node3"}},
+				{after: 15 * time.Second, nodes: []string{"node1", "node3"}, expTarget: "node1"},
+			},
+		},
+		{
+			name:     "Delayed failback starts over if a more preferred node becomes available",
+			failback: hcloudv1alpha1.FailbackAfterDelay,
+			delay:    60,
+			current:  "node3",
+			steps: []step{
+				{nodes: []string{"node2", "node3"}},
+				{after: 45 * time.Second, nodes: []string{"node1", "node2", "node3"}},
+				{after: 45 * time.Second, nodes: []string{"node1", "node2", "node3"}},
+				{after: 15 * time.Second, nodes: []string{"node1", "node2", "node3"}, expTarget: "node1"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeTime()
+			fip := &hcloudv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: hcloudv1alpha1.FloatinIPSpec{
+					PreferredNodes:       []hcloudv1alpha1.PreferredNode{{Name: "node1", Weight: 2}, {Name: "node2", Weight: 1}, {Name: "node3"}},
+					Failback:             test.failback,
+					FailbackDelaySeconds: test.delay,
+				},
+			}
+			p := &IPAssigner{fip: fip, time: clock, logger: kooperlog.Dummy}
+			current := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: test.current}}
+
+			for i, step := range test.steps {
+				clock.advance(step.after)
+				nodes := []corev1.Node{}
+				for _, name := range step.nodes {
+					nodes = append(nodes, corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+				}
+
+				got := ""
+				if target := p.failbackTarget(current, nodes); target != nil {
+					got = target.Name
+				}
+				if got != step.expTarget {
+					t.Errorf("step %d: expected target %q, got %q", i, step.expTarget, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	corev1 "k8s.io/api/core/v1"
+
+	hcloudfloatingipoperator "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud"
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+const (
+	// ipv6Label is the node label that overrides whether the node has ipv6
+	// connectivity, the value has to be true or false.
+	ipv6Label = hcloudfloatingipoperator.GroupName + "/ipv6"
+
+	// ipv6PrefixLength is the length of the networks of ipv6 floating ips.
+	ipv6PrefixLength = 64
+)
+
+// parseSpecIP parses an ip address or, for ipv6, a network prefix.
+func parseSpecIP(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		if network.IP.To4() != nil {
+			return nil, fmt.Errorf("ipv4 floating ips are single addresses, got prefix %s", s)
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip address %s", s)
+	}
+	if ip.To4() != nil {
+		return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// floatingIPNetwork returns the network of the hcloud floating ip, a single
+// address for ipv4 and the /64 network for ipv6.
+func floatingIPNetwork(fip *hcloud.FloatingIP) *net.IPNet {
+	if fip.Type == hcloud.FloatingIPTypeIPv6 || fip.IP.To4() == nil {
+		mask := net.CIDRMask(ipv6PrefixLength, 128)
+		return &net.IPNet{IP: fip.IP.Mask(mask), Mask: mask}
+	}
+	return &net.IPNet{IP: fip.IP.To4(), Mask: net.CIDRMask(32, 32)}
+}
+
+// matchesNetwork checks if the ip or prefix of the spec falls into the
+// network of the hcloud floating ip.
+func matchesNetwork(fip *hcloud.FloatingIP, spec *net.IPNet) bool {
+	network := floatingIPNetwork(fip)
+	ones, _ := spec.Mask.Size()
+	fipOnes, _ := network.Mask.Size()
+	return ones >= fipOnes && network.Contains(spec.IP)
+}
+
+// floatingIPFamily returns the address family of the hcloud floating ip.
+func floatingIPFamily(fip *hcloud.FloatingIP) hcloudv1alpha1.FloatingIPType {
+	if fip.Type == hcloud.FloatingIPTypeIPv6 || fip.IP.To4() == nil {
+		return hcloudv1alpha1.FloatingIPTypeIPv6
+	}
+	return hcloudv1alpha1.FloatingIPTypeIPv4
+}
+
+// floatingIPAddress returns the address of the hcloud floating ip as it is
+// written to the status, the network for ipv6.
+func floatingIPAddress(fip *hcloud.FloatingIP) string {
+	if floatingIPFamily(fip) == hcloudv1alpha1.FloatingIPTypeIPv6 {
+		return floatingIPNetwork(fip).String()
+	}
+	return fip.IP.String()
+}
+
+// filterFamily returns the nodes that can be targets for floating ips of the
+// address family.
+func filterFamily(nodes []corev1.Node, family hcloudv1alpha1.FloatingIPType) []corev1.Node {
+	if family != hcloudv1alpha1.FloatingIPTypeIPv6 {
+		return nodes
+	}
+
+	filtered := []corev1.Node{}
+	for i := range nodes {
+		if hasIPv6(&nodes[i]) {
+			filtered = append(filtered, nodes[i])
+		}
+	}
+	return filtered
+}
+
+// hasIPv6 checks if the node has ipv6 connectivity. The ipv6 label takes
+// precedence over the addresses of the node.
+func hasIPv6(node *corev1.Node) bool {
+	switch node.Labels[ipv6Label] {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	for _, addr := range node.Status.Addresses {
+		if addr.Type != corev1.NodeExternalIP && addr.Type != corev1.NodeInternalIP {
+			continue
+		}
+		ip := net.ParseIP(addr.Address)
+		if ip != nil && ip.To4() == nil && ip.IsGlobalUnicast() {
+			return true
+		}
+	}
+	return false
+}
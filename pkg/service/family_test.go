@@ -0,0 +1,149 @@
+package service
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+func TestMatchesNetwork(t *testing.T) {
+	ipv4 := &hcloud.FloatingIP{IP: net.ParseIP("192.0.2.10"), Type: hcloud.FloatingIPTypeIPv4}
+	ipv6 := &hcloud.FloatingIP{IP: net.ParseIP("2001:db8:1::"), Type: hcloud.FloatingIPTypeIPv6}
+
+	tests := []struct {
+		name     string
+		fip      *hcloud.FloatingIP
+		spec     string
+		expMatch bool
+		expErr   bool
+	}{
+		{
+			name:     "IPv4 address matches",
+			fip:      ipv4,
+			spec:     "192.0.2.10",
+			expMatch: true,
+		},
+		{
+			name: "Other ipv4 address does not match",
+			fip:  ipv4,
+			spec: "192.0.2.11",
+		},
+		{
+			name:   "IPv4 prefix is invalid",
+			fip:    ipv4,
+			spec:   "192.0.2.10/32",
+			expErr: true,
+		},
+		{
+			name:     "IPv6 address of the network matches",
+			fip:      ipv6,
+			spec:     "2001:db8:1::1",
+			expMatch: true,
+		},
+		{
+			name:     "IPv6 prefix of the network matches",
+			fip:      ipv6,
+			spec:     "2001:db8:1::/64",
+			expMatch: true,
+		},
+		{
+			name:     "Smaller ipv6 prefix inside the network matches",
+			fip:      ipv6,
+			spec:     "2001:db8:1:0:1::/80",
+			expMatch: true,
+		},
+		{
+			name: "Larger ipv6 prefix containing the network does not match",
+			fip:  ipv6,
+			spec: "2001:db8::/48",
+		},
+		{
+			name: "IPv6 address of another network does not match",
+			fip:  ipv6,
+			spec: "2001:db8:2::1",
+		},
+		{
+			name: "IPv4 address does not match an ipv6 floating ip",
+			fip:  ipv6,
+			spec: "192.0.2.10",
+		},
+		{
+			name:   "Invalid address is an error",
+			fip:    ipv4,
+			spec:   "192.0.2",
+			expErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			network, err := parseSpecIP(test.spec)
+
+			if test.expErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", network)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := matchesNetwork(test.fip, network); got != test.expMatch {
+				t.Errorf("expected match %t, got %t", test.expMatch, got)
+			}
+		})
+	}
+}
+
+func TestFilterFamily(t *testing.T) {
+	node := func(name string, labels map[string]string, addresses ...string) corev1.Node {
+		node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+		for _, addr := range addresses {
+			node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: addr})
+		}
+		return node
+	}
+	nodes := []corev1.Node{
+		node("ipv4", nil, "192.0.2.1"),
+		node("ipv6", nil, "192.0.2.2", "2001:db8:1::1"),
+		node("link-local", nil, "192.0.2.3", "fe80::1"),
+		node("disabled", map[string]string{ipv6Label: "false"}, "2001:db8:2::1"),
+		node("enabled", map[string]string{ipv6Label: "true"}, "192.0.2.4"),
+	}
+
+	tests := []struct {
+		name     string
+		family   hcloudv1alpha1.FloatingIPType
+		expNodes []string
+	}{
+		{
+			name:     "All nodes are targets for ipv4",
+			family:   hcloudv1alpha1.FloatingIPTypeIPv4,
+			expNodes: []string{"ipv4", "ipv6", "link-local", "disabled", "enabled"},
+		},
+		{
+			name:     "Nodes with global ipv6 addresses or the label are targets for ipv6",
+			family:   hcloudv1alpha1.FloatingIPTypeIPv6,
+			expNodes: []string{"ipv6", "enabled"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []string{}
+			for _, node := range filterFamily(nodes, test.family) {
+				got = append(got, node.Name)
+			}
+
+			if !reflect.DeepEqual(got, test.expNodes) {
+				t.Errorf("expected nodes %v, got %v", test.expNodes, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+var (
+	// defaultExcludeConditions are the node conditions that disqualify a
+	// node if no conditions are specified.
+	defaultExcludeConditions = []corev1.NodeConditionType{
+		corev1.NodeMemoryPressure,
+		corev1.NodeDiskPressure,
+		corev1.NodeNetworkUnavailable,
+	}
+
+	// defaultExcludeTaints are the taints that disqualify a node if no taints
+	// are specified.
+	defaultExcludeTaints = []hcloudv1alpha1.TaintSelector{
+		{Effect: corev1.TaintEffectNoExecute},
+	}
+)
+
+// isNodeHealthy checks if the node is ready and none of the excluding
+// conditions or taints of the health spec apply to it.
+func isNodeHealthy(node *corev1.Node, health *hcloudv1alpha1.NodeHealth) bool {
+	if !isNodeReady(node) {
+		return false
+	}
+
+	if health == nil {
+		health = &hcloudv1alpha1.NodeHealth{}
+	}
+
+	if node.Spec.Unschedulable && !health.AllowUnschedulable {
+		return false
+	}
+
+	conditions := health.ExcludeConditions
+	if conditions == nil {
+		conditions = defaultExcludeConditions
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Status == corev1.ConditionTrue && containsConditionType(conditions, cond.Type) {
+			return false
+		}
+	}
+
+	taints := health.ExcludeTaints
+	if taints == nil {
+		taints = defaultExcludeTaints
+	}
+	for _, taint := range node.Spec.Taints {
+		for _, sel := range taints {
+			if matchesTaint(sel, taint) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func containsConditionType(types []corev1.NodeConditionType, t corev1.NodeConditionType) bool {
+	for _, ct := range types {
+		if ct == t {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesTaint(sel hcloudv1alpha1.TaintSelector, taint corev1.Taint) bool {
+	if sel.Key != "" && sel.Key != taint.Key {
+		return false
+	}
+	if sel.Effect != "" && sel.Effect != taint.Effect {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,425 @@
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	hcloudfloatingipoperator "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud"
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+const (
+	// healthCheckLabel marks the pods running exec health checks with the
+	// name of the floating ip.
+	healthCheckLabel = hcloudfloatingipoperator.GroupName + "/health-check"
+
+	defaultHealthCheckTimeout   hcloudv1alpha1.Seconds = 1
+	defaultExecDeadline         hcloudv1alpha1.Seconds = 60
+	defaultExecPeriod           hcloudv1alpha1.Seconds = 30
+	defaultFailureThreshold                            = 3
+	defaultSuccessThreshold                            = 1
+	defaultExpectedStatus                              = http.StatusOK
+	defaultHealthCheckNamespace                        = "kube-system"
+)
+
+// probeResult is the outcome of a single health check probe.
+type probeResult int
+
+const (
+	// probeUnknown means the probe has no result yet, the state of the node
+	// is not changed.
+	probeUnknown probeResult = iota
+	probeSuccess
+	probeFailure
+)
+
+// healthState is the health of a node derived from the consecutive results
+// of its probes.
+type healthState struct {
+	known     bool
+	healthy   bool
+	successes int
+	failures  int
+}
+
+// observe records the result of a probe and returns true if the health of
+// the node changed. The first result of a node decides its health, after
+// that nodes only change their health after the threshold of consecutive
+// results, so flapping backends don't move the floating ip.
+func (h *healthState) observe(result probeResult, check *hcloudv1alpha1.HealthCheck) bool {
+	if !h.known {
+		if result == probeUnknown {
+			return false
+		}
+		h.known = true
+		h.healthy = result == probeSuccess
+		if h.healthy {
+			h.successes = 1
+		} else {
+			h.failures = 1
+		}
+		return false
+	}
+
+	switch result {
+	case probeSuccess:
+		h.successes++
+		h.failures = 0
+		if !h.healthy && h.successes >= threshold(check.SuccessThreshold, defaultSuccessThreshold) {
+			h.healthy = true
+			return true
+		}
+	case probeFailure:
+		h.failures++
+		h.successes = 0
+		if h.healthy && h.failures >= threshold(check.FailureThreshold, defaultFailureThreshold) {
+			h.healthy = false
+			return true
+		}
+	}
+	return false
+}
+
+func threshold(value, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
+
+// validateHealthCheck checks that exactly one kind of probe is set.
+func validateHealthCheck(check *hcloudv1alpha1.HealthCheck) error {
+	set := 0
+	if check.TCP != nil {
+		set++
+	}
+	if check.HTTP != nil {
+		set++
+	}
+	if check.Exec != nil {
+		set++
+		if check.Exec.Image == "" || len(check.Exec.Command) == 0 {
+			return newReconcileError(reasonInvalidSpec, fmt.Errorf("exec health check needs an image and a command"))
+		}
+	}
+	if set != 1 {
+		return newReconcileError(reasonInvalidSpec, fmt.Errorf("health check needs exactly one of tcp, http and exec"))
+	}
+	return nil
+}
+
+// filterHealthChecked probes all nodes and returns the ones that are
+// healthy. Without a health check all nodes are returned.
+func (p *IPAssigner) filterHealthChecked(nodes []corev1.Node) ([]corev1.Node, error) {
+	check := p.fip.Spec.HealthCheck
+	if check == nil {
+		return nodes, nil
+	}
+	if err := validateHealthCheck(check); err != nil {
+		return nil, err
+	}
+
+	results, err := p.probeNodes(nodes, check)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.health == nil {
+		p.health = map[string]*healthState{}
+	}
+	current := map[string]bool{}
+	healthy := []corev1.Node{}
+	for i, node := range nodes {
+		current[node.Name] = true
+		state, ok := p.health[node.Name]
+		if !ok {
+			// The health is kept in memory, nodes holding the floating ip
+			// stay healthy after a restart until their probes fail.
+			state = &healthState{}
+			if p.IsAssignedTo(node.Name) {
+				state.known = true
+				state.healthy = true
+			}
+			p.health[node.Name] = state
+		}
+
+		if state.observe(results[i], check) {
+			p.recordHealthTransition(node.Name, state.healthy)
+		}
+		if state.healthy {
+			healthy = append(healthy, node)
+		}
+	}
+
+	// Forget nodes that are no longer candidates, their first probe decides
+	// their health when they come back.
+	for name := range p.health {
+		if !current[name] {
+			delete(p.health, name)
+		}
+	}
+
+	return healthy, nil
+}
+
+// recordHealthTransition emits an event for the changed health of a node.
+func (p *IPAssigner) recordHealthTransition(node string, healthy bool) {
+	if healthy {
+		p.logger.Infof("%s health check of node %s succeeded", p.fip.Name, node)
+		p.recorder.Eventf(p.fip, corev1.EventTypeNormal, reasonHealthCheckSucceeded, "health check of node %s succeeded", node)
+		return
+	}
+	p.logger.Warningf("%s health check of node %s failed", p.fip.Name, node)
+	p.recorder.Eventf(p.fip, corev1.EventTypeWarning, reasonHealthCheckFailed, "health check of node %s failed", node)
+}
+
+// probeNodes runs the health check against all nodes in parallel and
+// returns the results in the order of the nodes.
+func (p *IPAssigner) probeNodes(nodes []corev1.Node, check *hcloudv1alpha1.HealthCheck) ([]probeResult, error) {
+	results := make([]probeResult, len(nodes))
+	if check.Exec != nil {
+		return results, p.probeExec(nodes, check, results)
+	}
+
+	timeout := time.Duration(check.TimeoutSeconds) * time.Second
+	if check.TimeoutSeconds <= 0 {
+		timeout = time.Duration(defaultHealthCheckTimeout) * time.Second
+	}
+
+	var wg sync.WaitGroup
+	for i := range nodes {
+		addr := nodeAddress(&nodes[i])
+		if addr == "" {
+			results[i] = probeFailure
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			if check.TCP != nil {
+				results[i] = probeTCP(addr, check.TCP, timeout)
+			} else {
+				results[i] = probeHTTP(addr, check.HTTP, timeout)
+			}
+		}(i, addr)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// nodeAddress returns the internal address of the node, falling back to
+// the external address.
+func nodeAddress(node *corev1.Node) string {
+	for _, t := range []corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP} {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == t {
+				return addr.Address
+			}
+		}
+	}
+	return ""
+}
+
+func probeTCP(addr string, check *hcloudv1alpha1.TCPHealthCheck, timeout time.Duration) probeResult {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr, strconv.Itoa(int(check.Port))), timeout)
+	if err != nil {
+		return probeFailure
+	}
+	conn.Close()
+	return probeSuccess
+}
+
+func probeHTTP(addr string, check *hcloudv1alpha1.HTTPHealthCheck, timeout time.Duration) probeResult {
+	scheme := "http"
+	if check.Scheme == "HTTPS" {
+		scheme = "https"
+	}
+	path := check.Path
+	if path == "" {
+		path = "/"
+	}
+	expected := check.ExpectedStatus
+	if expected == 0 {
+		expected = defaultExpectedStatus
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(addr, strconv.Itoa(int(check.Port))), path)
+	resp, err := client.Get(url)
+	if err != nil {
+		return probeFailure
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != expected {
+		return probeFailure
+	}
+	return probeSuccess
+}
+
+// probeExec collects the results of the finished health check pods and
+// starts a new pod on every node that has none, at most once per period.
+// Pods of nodes that are no longer candidates are removed.
+func (p *IPAssigner) probeExec(nodes []corev1.Node, check *hcloudv1alpha1.HealthCheck, results []probeResult) error {
+	pods := p.k8sCli.CoreV1().Pods(p.healthCheckNamespace())
+	list, err := pods.List(p.healthCheckPodOptions())
+	if err != nil {
+		return err
+	}
+
+	period := time.Duration(check.Exec.PeriodSeconds) * time.Second
+	if check.Exec.PeriodSeconds <= 0 {
+		period = time.Duration(defaultExecPeriod) * time.Second
+	}
+	if p.execStarts == nil {
+		p.execStarts = map[string]time.Time{}
+	}
+
+	byNode := map[string]*corev1.Pod{}
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		byNode[pod.Spec.NodeName] = pod
+	}
+
+	current := map[string]bool{}
+	for i := range nodes {
+		node := &nodes[i]
+		current[node.Name] = true
+		pod, ok := byNode[node.Name]
+		delete(byNode, node.Name)
+
+		if ok {
+			switch pod.Status.Phase {
+			case corev1.PodSucceeded:
+				results[i] = probeSuccess
+			case corev1.PodFailed:
+				results[i] = probeFailure
+			default:
+				// The probe is still running.
+				continue
+			}
+			if err := pods.Delete(pod.Name, &metav1.DeleteOptions{}); err != nil {
+				p.logger.Warningf("%s error deleting health check pod %s: %s", p.fip.Name, pod.Name, err)
+				continue
+			}
+		}
+
+		if started, ok := p.execStarts[node.Name]; ok && p.time.Now().Sub(started) < period {
+			continue
+		}
+		if _, err := pods.Create(p.healthCheckPod(node, check)); err != nil {
+			p.logger.Warningf("%s error creating health check pod on node %s: %s", p.fip.Name, node.Name, err)
+			continue
+		}
+		p.execStarts[node.Name] = p.time.Now()
+	}
+
+	for name := range p.execStarts {
+		if !current[name] {
+			delete(p.execStarts, name)
+		}
+	}
+	for _, pod := range byNode {
+		if err := pods.Delete(pod.Name, &metav1.DeleteOptions{}); err != nil {
+			p.logger.Warningf("%s error deleting health check pod %s: %s", p.fip.Name, pod.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// healthCheckPod returns a pod that runs the exec health check once on the
+// node.
+func (p *IPAssigner) healthCheckPod(node *corev1.Node, check *hcloudv1alpha1.HealthCheck) *corev1.Pod {
+	deadline := int64(check.Exec.DeadlineSeconds)
+	if deadline <= 0 {
+		deadline = int64(defaultExecDeadline)
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: p.fip.Name + "-health-",
+			Labels: map[string]string{
+				healthCheckLabel: p.fip.Name,
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:              node.Name,
+			HostNetwork:           true,
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &deadline,
+			Tolerations: []corev1.Toleration{
+				{Operator: corev1.TolerationOpExists},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "health-check",
+					Image:   check.Exec.Image,
+					Command: check.Exec.Command,
+					Env: []corev1.EnvVar{
+						{Name: "NODE_ADDRESS", Value: nodeAddress(node)},
+					},
+				},
+			},
+		},
+	}
+}
+
+// deleteHealthCheckPods removes all pods of the exec health check of the
+// floating ip.
+func (p *IPAssigner) deleteHealthCheckPods() error {
+	check := p.fip.Spec.HealthCheck
+	if check == nil || check.Exec == nil {
+		return nil
+	}
+
+	pods := p.k8sCli.CoreV1().Pods(p.healthCheckNamespace())
+	list, err := pods.List(p.healthCheckPodOptions())
+	if err != nil {
+		return err
+	}
+	for _, pod := range list.Items {
+		if err := pods.Delete(pod.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting health check pod %s: %s", pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// healthCheckPodOptions selects the pods of the exec health check of the
+// floating ip.
+func (p *IPAssigner) healthCheckPodOptions() metav1.ListOptions {
+	sel := labels.Set{healthCheckLabel: p.fip.Name}.AsSelector()
+	return metav1.ListOptions{LabelSelector: sel.String()}
+}
+
+// healthCheckNamespace returns the namespace of the operator the pods of
+// exec health checks run in. Resources can not choose it, so they can not
+// run pods in the host network of nodes in other namespaces.
+func (p *IPAssigner) healthCheckNamespace() string {
+	if p.cfg.Namespace == "" {
+		return defaultHealthCheckNamespace
+	}
+	return p.cfg.Namespace
+}
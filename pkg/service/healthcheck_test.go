@@ -0,0 +1,190 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+func TestHealthStateObserve(t *testing.T) {
+	s, f, u := probeSuccess, probeFailure, probeUnknown
+
+	tests := []struct {
+		name       string
+		check      hcloudv1alpha1.HealthCheck
+		results    []probeResult
+		expChanges []bool
+		expKnown   bool
+		expHealthy bool
+	}{
+		{
+			name:       "Unknown results leave the health unknown",
+			results:    []probeResult{u, u},
+			expChanges: []bool{false, false},
+		},
+		{
+			name:       "First success decides the health",
+			results:    []probeResult{u, s},
+			expChanges: []bool{false, false},
+			expKnown:   true,
+			expHealthy: true,
+		},
+		{
+			name:       "First failure decides the health",
+			results:    []probeResult{f},
+			expChanges: []bool{false},
+			expKnown:   true,
+		},
+		{
+			name:       "Healthy node fails after the default failure threshold",
+			results:    []probeResult{s, f, f, f},
+			expChanges: []bool{false, false, false, true},
+			expKnown:   true,
+		},
+		{
+			name:       "Healthy node fails after the failure threshold",
+			check:      hcloudv1alpha1.HealthCheck{FailureThreshold: 1},
+			results:    []probeResult{s, f},
+			expChanges: []bool{false, true},
+			expKnown:   true,
+		},
+		{
+			name:       "Success resets the consecutive failures",
+			results:    []probeResult{s, f, f, s, f, f},
+			expChanges: []bool{false, false, false, false, false, false},
+			expKnown:   true,
+			expHealthy: true,
+		},
+		{
+			name:       "Unknown results keep the consecutive failures",
+			results:    []probeResult{s, f, u, f, u, f},
+			expChanges: []bool{false, false, false, false, false, true},
+			expKnown:   true,
+		},
+		{
+			name:       "Unhealthy node recovers after the default success threshold",
+			results:    []probeResult{f, s},
+			expChanges: []bool{false, true},
+			expKnown:   true,
+			expHealthy: true,
+		},
+		{
+			name:       "Unhealthy node recovers after the success threshold",
+			check:      hcloudv1alpha1.HealthCheck{SuccessThreshold: 3},
+			results:    []probeResult{f, s, s, f, s, s, s},
+			expChanges: []bool{false, false, false, false, false, false, true},
+			expKnown:   true,
+			expHealthy: true,
+		},
+		{
+			name:       "Further successes do not change a healthy node",
+			results:    []probeResult{s, s, s},
+			expChanges: []bool{false, false, false},
+			expKnown:   true,
+			expHealthy: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := &healthState{}
+			changes := []bool{}
+			for _, result := range test.results {
+				changes = append(changes, state.observe(result, &test.check))
+			}
+
+			if !reflect.DeepEqual(changes, test.expChanges) {
+				t.Errorf("expected changes %v, got %v", test.expChanges, changes)
+			}
+			if state.known != test.expKnown {
+				t.Errorf("expected known %t, got %t", test.expKnown, state.known)
+			}
+			if state.healthy != test.expHealthy {
+				t.Errorf("expected healthy %t, got %t", test.expHealthy, state.healthy)
+			}
+		})
+	}
+}
+
+func TestIPAssignerProbeExec(t *testing.T) {
+	check := &hcloudv1alpha1.HealthCheck{
+		Exec: &hcloudv1alpha1.ExecHealthCheck{
+			Image:         "busybox",
+			Command:       []string{"true"},
+			PeriodSeconds: 300,
+		},
+	}
+	nodes := []corev1.Node{*testNode("node1", 1, true)}
+
+	clock := newFakeTime()
+	k8sCli := k8sfake.NewSimpleClientset()
+	fip := &hcloudv1alpha1.FloatingIP{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec:       hcloudv1alpha1.FloatinIPSpec{HealthCheck: check},
+	}
+	p := &IPAssigner{cfg: Config{Namespace: "operator"}, fip: fip, k8sCli: k8sCli, time: clock, logger: kooperlog.Dummy}
+
+	probe := func() probeResult {
+		results := make([]probeResult, len(nodes))
+		if err := p.probeExec(nodes, check, results); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return results[0]
+	}
+	listPods := func() []corev1.Pod {
+		pods, err := k8sCli.CoreV1().Pods("operator").List(metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pods.Items
+	}
+
+	// The first probe starts a pod in the namespace of the operator.
+	if got := probe(); got != probeUnknown {
+		t.Errorf("expected unknown result of the started probe, got %d", got)
+	}
+	pods := listPods()
+	if len(pods) != 1 || pods[0].Spec.NodeName != "node1" {
+		t.Fatalf("expected a health check pod on node1, got %v", pods)
+	}
+
+	// A running pod has no result and is not replaced.
+	clock.advance(time.Minute)
+	if got := probe(); got != probeUnknown {
+		t.Errorf("expected unknown result of the running probe, got %d", got)
+	}
+	if pods := listPods(); len(pods) != 1 {
+		t.Fatalf("expected the running health check pod, got %d pods", len(pods))
+	}
+
+	// A finished pod started within the period is not replaced right away.
+	clock.advance(time.Second)
+	pod := pods[0]
+	pod.Status.Phase = corev1.PodSucceeded
+	if _, err := k8sCli.CoreV1().Pods("operator").UpdateStatus(&pod); err != nil {
+		t.Fatal(err)
+	}
+	if got := probe(); got != probeSuccess {
+		t.Errorf("expected successful result of the finished probe, got %d", got)
+	}
+	if pods := listPods(); len(pods) != 0 {
+		t.Fatalf("expected no health check pod within the period, got %d pods", len(pods))
+	}
+	if got := probe(); got != probeUnknown {
+		t.Errorf("expected unknown result without a probe, got %d", got)
+	}
+
+	// After the period the next pod is started.
+	clock.advance(5 * time.Minute)
+	probe()
+	if pods := listPods(); len(pods) != 1 {
+		t.Fatalf("expected a new health check pod after the period, got %d pods", len(pods))
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+const (
+	// defaultMoveWindow is the window moves are counted in if the
+	// hysteresis sets none.
+	defaultMoveWindow hcloudv1alpha1.Seconds = 3600
+)
+
+// holdFloatingIP checks if the hysteresis of the spec allows to move the
+// floating ip of the assignment away from its current node. Optional moves
+// leave a floating ip that is on a valid target, only they are paused after
+// too many moves. If a non critical move is deferred the node the floating
+// ip stays on is returned. Critical moves that are deferred and paused
+// moves are returned as errors.
+func (p *IPAssigner) holdFloatingIP(assignment *hcloudv1alpha1.FloatingIPAssignment, hetznerIP *hcloud.FloatingIP, optional bool) (*corev1.Node, error) {
+	hyst := p.fip.Spec.Hysteresis
+	if hyst == nil || hetznerIP.Server == nil {
+		return nil, nil
+	}
+
+	node, err := p.getAssignedNode(hetznerIP)
+	if err != nil {
+		return nil, err
+	}
+	critical := node == nil || !isNodeReady(node)
+
+	now := p.time.Now()
+	since := assignment.LastTransitionTime
+	assignment.RecentMoves = pruneMoves(assignment.RecentMoves, hyst, now)
+	if optional && hyst.MaxMoves > 0 && len(assignment.RecentMoves) >= hyst.MaxMoves {
+		resume := assignment.RecentMoves[0].Add(moveWindow(hyst))
+		return nil, newReconcileError(reasonReassignmentPaused, fmt.Errorf("%s ip assigner: %d moves within %s, optional moves of %s paused until %s", p.fip.Name, len(assignment.RecentMoves), moveWindow(hyst), hetznerIP.IP, resume.Format(time.RFC3339)))
+	}
+
+	cooldown := time.Duration(hyst.CooldownSeconds) * time.Second
+	if cooldown > 0 && now.Before(since.Add(cooldown)) {
+		if critical {
+			return nil, newReconcileError(reasonReassignmentDeferred, fmt.Errorf("%s ip assigner: node of %s is lost, reassignment deferred until the cooldown ends at %s", p.fip.Name, hetznerIP.IP, since.Add(cooldown).Format(time.RFC3339)))
+		}
+		p.logger.Infof("%s ip assigner keeps %s on node %s until the cooldown ends at %s", p.fip.Name, hetznerIP.IP, node.Name, since.Add(cooldown).Format(time.RFC3339))
+		return node, nil
+	}
+
+	dwell := time.Duration(hyst.MinDwellSeconds) * time.Second
+	if !critical && dwell > 0 && now.Before(since.Add(dwell)) {
+		p.logger.Infof("%s ip assigner keeps %s on node %s until the minimum dwell time ends at %s", p.fip.Name, hetznerIP.IP, node.Name, since.Add(dwell).Format(time.RFC3339))
+		return node, nil
+	}
+
+	return nil, nil
+}
+
+// getAssignedNode returns the node of the server the floating ip is
+// assigned to regardless of whether it is a probable target, nil if there
+// is none.
+func (p *IPAssigner) getAssignedNode(hetznerIP *hcloud.FloatingIP) (*corev1.Node, error) {
+	return p.getCurrentNode(hetznerIP, p.listNodes(labels.Everything()))
+}
+
+// recordMove adds a move of the floating ip of the assignment between two
+// nodes to its moves counted by the hysteresis.
+func (p *IPAssigner) recordMove(assignment *hcloudv1alpha1.FloatingIPAssignment, source, target string) {
+	hyst := p.fip.Spec.Hysteresis
+	if hyst == nil || hyst.MaxMoves <= 0 || source == "" || source == target {
+		return
+	}
+
+	now := p.time.Now()
+	assignment.RecentMoves = append(pruneMoves(assignment.RecentMoves, hyst, now), metav1.NewTime(now))
+}
+
+// pruneMoves returns the moves that are still within the window of the
+// hysteresis.
+func pruneMoves(moves []metav1.Time, hyst *hcloudv1alpha1.Hysteresis, now time.Time) []metav1.Time {
+	start := now.Add(-moveWindow(hyst))
+	var recent []metav1.Time
+	for _, t := range moves {
+		if t.Time.After(start) {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+func moveWindow(hyst *hcloudv1alpha1.Hysteresis) time.Duration {
+	if hyst.WindowSeconds <= 0 {
+		return time.Duration(defaultMoveWindow) * time.Second
+	}
+	return time.Duration(hyst.WindowSeconds) * time.Second
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	floatingipfake "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned/fake"
+	cloudfake "github.com/apricote/hcloud-floating-ip-operator/pkg/cloud/fake"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/metrics"
+)
+
+func TestIPAssignerHoldFloatingIP(t *testing.T) {
+	// Moves are given relative to the clock.
+	ago := func(clock *fakeTime, ds ...time.Duration) []metav1.Time {
+		var moves []metav1.Time
+		for _, d := range ds {
+			moves = append(moves, metav1.NewTime(clock.Now().Add(-d)))
+		}
+		return moves
+	}
+
+	tests := []struct {
+		name       string
+		hysteresis hcloudv1alpha1.Hysteresis
+		ready      bool
+		optional   bool
+		since      time.Duration
+		moves      []time.Duration
+		expErr     bool
+		expReason  string
+		expHeld    bool
+		expMoves   int
+	}{
+		{
+			name:       "Cooldown defers critical moves",
+			hysteresis: hcloudv1alpha1.Hysteresis{CooldownSeconds: 60},
+			since:      10 * time.Second,
+			expErr:     true,
+			expReason:  reasonReassignmentDeferred,
+		},
+		{
+			name:       "Cooldown keeps the floating ip for non critical moves",
+			hysteresis: hcloudv1alpha1.Hysteresis{CooldownSeconds: 60},
+			ready:      true,
+			since:      10 * time.Second,
+			expHeld:    true,
+		},
+		{
+			name:       "Ended cooldown allows critical moves",
+			hysteresis: hcloudv1alpha1.Hysteresis{CooldownSeconds: 60},
+			since:      time.Minute,
+		},
+		{
+			name:       "Minimum dwell time keeps the floating ip for non critical moves",
+			hysteresis: hcloudv1alpha1.Hysteresis{MinDwellSeconds: 60},
+			ready:      true,
+			since:      10 * time.Second,
+			expHeld:    true,
+		},
+		{
+			name:       "Minimum dwell time allows critical moves",
+			hysteresis: hcloudv1alpha1.Hysteresis{MinDwellSeconds: 60},
+			since:      10 * time.Second,
+		},
+		{
+			name:       "Maximum moves pause optional moves",
+			hysteresis: hcloudv1alpha1.Hysteresis{MaxMoves: 2},
+			ready:      true,
+			optional:   true,
+			since:      10 * time.Minute,
+			moves:      []time.Duration{30 * time.Minute, 10 * time.Minute},
+			expErr:     true,
+			expReason:  reasonReassignmentPaused,
+			expMoves:   2,
+		},
+		{
+			name:       "Maximum moves do not pause critical moves",
+			hysteresis: hcloudv1alpha1.Hysteresis{MaxMoves: 2},
+			since:      10 * time.Minute,
+			moves:      []time.Duration{30 * time.Minute, 10 * time.Minute},
+			expMoves:   2,
+		},
+		{
+			name:       "Maximum moves do not pause non critical moves off an invalid target",
+			hysteresis: hcloudv1alpha1.Hysteresis{MaxMoves: 2},
+			ready:      true,
+			since:      10 * time.Minute,
+			moves:      []time.Duration{30 * time.Minute, 10 * time.Minute},
+			expMoves:   2,
+		},
+		{
+			name:       "Moves leave the default window",
+			hysteresis: hcloudv1alpha1.Hysteresis{MaxMoves: 2},
+			ready:      true,
+			optional:   true,
+			since:      10 * time.Minute,
+			moves:      []time.Duration{2 * time.Hour, 10 * time.Minute},
+			expMoves:   1,
+		},
+		{
+			name:       "Moves leave the window",
+			hysteresis: hcloudv1alpha1.Hysteresis{MaxMoves: 2, WindowSeconds: 900},
+			ready:      true,
+			optional:   true,
+			since:      10 * time.Minute,
+			moves:      []time.Duration{30 * time.Minute, 10 * time.Minute},
+			expMoves:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := newFakeTime()
+			nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+			if err := nodes.Add(testNode("node1", 1, test.ready)); err != nil {
+				t.Fatal(err)
+			}
+
+			fip := &hcloudv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec:       hcloudv1alpha1.FloatinIPSpec{Hysteresis: &test.hysteresis},
+			}
+			p := &IPAssigner{fip: fip, nodes: nodes, time: clock, logger: kooperlog.Dummy}
+
+			hetznerIP := &hcloud.FloatingIP{ID: 10, IP: net.ParseIP("192.0.2.10"), Server: &hcloud.Server{ID: 1}}
+			assignment := &hcloudv1alpha1.FloatingIPAssignment{
+				NodeName:           "node1",
+				LastTransitionTime: metav1.NewTime(clock.Now().Add(-test.since)),
+				RecentMoves:        ago(clock, test.moves...),
+			}
+
+			held, err := p.holdFloatingIP(assignment, hetznerIP, test.optional)
+
+			if test.expErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				if reason := errorReason(err); reason != test.expReason {
+					t.Errorf("expected reason %s, got %s: %s", test.expReason, reason, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if test.expHeld && (held == nil || held.Name != "node1") {
+				t.Errorf("expected the floating ip to be held on node1, got %v", held)
+			}
+			if !test.expHeld && held != nil {
+				t.Errorf("expected the floating ip to be moved, held on %s", held.Name)
+			}
+			if got := len(assignment.RecentMoves); got != test.expMoves {
+				t.Errorf("expected %d recent moves, got %d", test.expMoves, got)
+			}
+		})
+	}
+}
+
+func TestIPAssignerRecordsMovesPerFloatingIP(t *testing.T) {
+	clock := newFakeTime()
+	servers := []*hcloud.Server{{ID: 1, Name: "node1"}, {ID: 2, Name: "node2"}}
+	fips := []*hcloud.FloatingIP{
+		{ID: 10, IP: net.ParseIP("192.0.2.10"), Type: hcloud.FloatingIPTypeIPv4, Server: &hcloud.Server{ID: 1}},
+		{ID: 11, IP: net.ParseIP("192.0.2.11"), Type: hcloud.FloatingIPTypeIPv4, Server: &hcloud.Server{ID: 2}},
+	}
+	cloudCli := cloudfake.NewClient(fips, servers)
+
+	// Node1 is lost, only the floating ip on it is moved.
+	nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, node := range []*corev1.Node{testNode("node1", 1, false), testNode("node2", 2, true)} {
+		if err := nodes.Add(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	earlier := metav1.NewTime(clock.Now().Add(-10 * time.Minute))
+	fip := &hcloudv1alpha1.FloatingIP{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: hcloudv1alpha1.FloatinIPSpec{
+			IPs:          []string{"192.0.2.10", "192.0.2.11"},
+			Distribution: hcloudv1alpha1.DistributionSpread,
+			Strategy:     hcloudv1alpha1.StrategyFirstByName,
+			Hysteresis:   &hcloudv1alpha1.Hysteresis{MaxMoves: 2},
+		},
+		Status: hcloudv1alpha1.FloatingIPStatus{
+			IPs: []hcloudv1alpha1.FloatingIPAssignment{
+				{Reference: "192.0.2.10", NodeName: "node1", ServerID: 1, RecentMoves: []metav1.Time{earlier}},
+				{Reference: "192.0.2.11", NodeName: "node2", ServerID: 2, RecentMoves: []metav1.Time{earlier}},
+			},
+			RecentMoves: []metav1.Time{earlier, earlier},
+		},
+	}
+	fipCli := floatingipfake.NewSimpleClientset(fip.DeepCopy())
+
+	p := NewCustomIPAssigner(Config{}, fip, k8sfake.NewSimpleClientset(), fipCli, cloudCli, nodes, newPodIndexer(), record.NewFakeRecorder(100), metrics.Dummy, nil, clock, kooperlog.Dummy)
+	if err := p.reconcile(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := fipCli.HcloudV1alpha1().FloatingIPs().Get("test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Status.IPs) != 2 {
+		t.Fatalf("expected 2 assignments, got %v", got.Status.IPs)
+	}
+	if moves := len(got.Status.IPs[0].RecentMoves); moves != 2 || got.Status.IPs[0].NodeName != "node2" {
+		t.Errorf("expected the moved floating ip on node2 with 2 moves, got %s with %d moves", got.Status.IPs[0].NodeName, moves)
+	}
+	if moves := len(got.Status.IPs[1].RecentMoves); moves != 1 {
+		t.Errorf("expected 1 move of the kept floating ip, got %d", moves)
+	}
+	if got.Status.RecentMoves != nil {
+		t.Errorf("expected no moves shared by the pool, got %v", got.Status.RecentMoves)
+	}
+}
@@ -3,8 +3,6 @@ package service
 import (
 	"context"
 	"fmt"
-	"math/rand"
-	"net"
 	"reflect"
 	"sync"
 	"time"
@@ -13,11 +11,17 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/hetznercloud/hcloud-go/hcloud"
 
 	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	floatingipk8scli "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/agent"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
 	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/metrics"
 )
 
 const (
@@ -40,36 +44,67 @@ func (t *timeStd) Now() time.Time                         { return time.Now() }
 
 // IPAssigner will verify ip assignment at regular intervals.
 type IPAssigner struct {
-	fip       *hcloudv1alpha1.FloatingIP
-	k8sCli    kubernetes.Interface
-	hcloudCli *hcloud.Client
-	logger    log.Logger
-	time      TimeWrapper
-
-	running bool
-	mutex   sync.Mutex
-	stopC   chan struct{}
+	cfg      Config
+	fip      *hcloudv1alpha1.FloatingIP
+	k8sCli   kubernetes.Interface
+	fipCli   floatingipk8scli.Interface
+	cloudCli cloud.Client
+	nodes    cache.Store
+	pods     cache.Indexer
+	recorder record.EventRecorder
+	metrics  metrics.Recorder
+	loader   NodeLoader
+	logger   log.Logger
+	time     TimeWrapper
+
+	// health, execStarts and failback are only used by the run loop and
+	// need no lock.
+	health     map[string]*healthState
+	execStarts map[string]time.Time
+	failback   failbackState
+
+	running  bool
+	mutex    sync.Mutex
+	stopC    chan struct{}
+	doneC    chan struct{}
+	triggerC chan struct{}
 }
 
 // NewIPAssigner returns a new ip assigner.
-func NewIPAssigner(fip *hcloudv1alpha1.FloatingIP, k8sCli kubernetes.Interface, hcloudCli *hcloud.Client, logger log.Logger) *IPAssigner {
+func NewIPAssigner(cfg Config, fip *hcloudv1alpha1.FloatingIP, k8sCli kubernetes.Interface, fipCli floatingipk8scli.Interface, cloudCli cloud.Client, nodes cache.Store, pods cache.Indexer, recorder record.EventRecorder, metricsRec metrics.Recorder, loader NodeLoader, logger log.Logger) *IPAssigner {
 	return &IPAssigner{
-		fip:       fip,
-		k8sCli:    k8sCli,
-		hcloudCli: hcloudCli,
-		logger:    logger,
-		time:      &timeStd{},
+		cfg:      cfg,
+		fip:      fip,
+		k8sCli:   k8sCli,
+		fipCli:   fipCli,
+		cloudCli: cloudCli,
+		nodes:    nodes,
+		pods:     pods,
+		recorder: recorder,
+		metrics:  metricsRec,
+		loader:   loader,
+		logger:   logger,
+		time:     &timeStd{},
+		triggerC: make(chan struct{}, 1),
 	}
 }
 
 // NewCustomIPAssigner is a constructor that lets you customize everything on the object construction.
-func NewCustomIPAssigner(fip *hcloudv1alpha1.FloatingIP, k8sCli kubernetes.Interface, hcloudCli *hcloud.Client, time TimeWrapper, logger log.Logger) *IPAssigner {
+func NewCustomIPAssigner(cfg Config, fip *hcloudv1alpha1.FloatingIP, k8sCli kubernetes.Interface, fipCli floatingipk8scli.Interface, cloudCli cloud.Client, nodes cache.Store, pods cache.Indexer, recorder record.EventRecorder, metricsRec metrics.Recorder, loader NodeLoader, time TimeWrapper, logger log.Logger) *IPAssigner {
 	return &IPAssigner{
-		fip:       fip,
-		k8sCli:    k8sCli,
-		hcloudCli: hcloudCli,
-		logger:    logger,
-		time:      time,
+		cfg:      cfg,
+		fip:      fip,
+		k8sCli:   k8sCli,
+		fipCli:   fipCli,
+		cloudCli: cloudCli,
+		nodes:    nodes,
+		pods:     pods,
+		recorder: recorder,
+		metrics:  metricsRec,
+		loader:   loader,
+		logger:   logger,
+		time:     time,
+		triggerC: make(chan struct{}, 1),
 	}
 }
 
@@ -78,6 +113,72 @@ func (p *IPAssigner) SameSpec(fip *hcloudv1alpha1.FloatingIP) bool {
 	return reflect.DeepEqual(p.fip.Spec, fip.Spec)
 }
 
+// AssignedNodes returns the names of the nodes the floating ips were last
+// observed on, one entry per floating ip.
+func (p *IPAssigner) AssignedNodes() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	nodes := []string{}
+	if len(p.fip.Status.IPs) > 0 {
+		for _, a := range p.fip.Status.IPs {
+			if a.NodeName != "" {
+				nodes = append(nodes, a.NodeName)
+			}
+		}
+		return nodes
+	}
+
+	if p.fip.Status.NodeName != "" {
+		nodes = append(nodes, p.fip.Status.NodeName)
+	}
+	return nodes
+}
+
+// IsAssignedTo checks if one of the floating ips was last observed on the
+// node.
+func (p *IPAssigner) IsAssignedTo(name string) bool {
+	for _, node := range p.AssignedNodes() {
+		if node == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTarget checks if the node is a valid target for the floating ip.
+func (p *IPAssigner) IsTarget(node *corev1.Node) bool {
+	sel := labels.SelectorFromSet(labels.Set(p.fip.Spec.NodeSelector))
+	return sel.Matches(labels.Set(node.Labels)) && isNodeHealthy(node, p.fip.Spec.NodeHealth)
+}
+
+// SelectsPod checks if the pod is selected by the pod selector of the
+// floating ip.
+func (p *IPAssigner) SelectsPod(pod *corev1.Pod) bool {
+	if p.fip.Spec.PodSelector == nil {
+		return false
+	}
+	if p.fip.Spec.PodNamespace != "" && p.fip.Spec.PodNamespace != pod.Namespace {
+		return false
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(p.fip.Spec.PodSelector)
+	if err != nil {
+		return false
+	}
+	return sel.Matches(labels.Set(pod.Labels))
+}
+
+// Trigger will run a reconcilation as soon as possible without waiting for
+// the next interval.
+func (p *IPAssigner) Trigger() {
+	select {
+	case p.triggerC <- struct{}{}:
+	default:
+		// There is already a pending reconcilation.
+	}
+}
+
 // Start will run the ip assigner at regular intervals.
 func (p *IPAssigner) Start() error {
 	p.mutex.Lock()
@@ -87,9 +188,11 @@ func (p *IPAssigner) Start() error {
 	}
 
 	p.stopC = make(chan struct{})
+	p.doneC = make(chan struct{})
 	p.running = true
 
 	go func() {
+		defer close(p.doneC)
 		p.logger.Infof("started %s ip assigner", p.fip.Name)
 		if err := p.run(); err != nil {
 			p.logger.Errorf("error executing ip assigner: %s", err)
@@ -99,39 +202,171 @@ func (p *IPAssigner) Start() error {
 	return nil
 }
 
-// Stop stops the ip assigner.
+// Stop stops the ip assigner and waits until a running reconcilation
+// finished, so no assignment happens after it returned. The pods of exec
+// health checks are removed.
 func (p *IPAssigner) Stop() error {
 	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	if p.running {
-		close(p.stopC)
-		p.logger.Infof("stopped %s ip assigner", p.fip.Name)
+	if !p.running {
+		p.mutex.Unlock()
+		return nil
 	}
-
+	close(p.stopC)
+	doneC := p.doneC
 	p.running = false
-	return nil
+	p.mutex.Unlock()
+
+	// The run loop takes the lock to update the status, so it is waited
+	// for without holding it.
+	<-doneC
+	p.logger.Infof("stopped %s ip assigner", p.fip.Name)
+
+	return p.deleteHealthCheckPods()
 }
 
-// run will run the loop that will kill eventually the required pods.
+// run will run the loop that will verify the assignment at every interval.
+// Failures of the apis are retried with an exponential backoff, other
+// transient errors at the normal interval. Permanent errors are not retried
+// until the spec changes and the ip assigner is recreated.
 func (p *IPAssigner) run() error {
+	interval := time.Duration(max(p.fip.Spec.IntervalSeconds, MinimalIntervalSeconds)) * time.Second
+	wait := interval
+	failures := 0
 	for {
-		select {
-		case <-p.time.After(time.Duration(max(p.fip.Spec.IntervalSeconds, MinimalIntervalSeconds)) * time.Second):
-			if err := p.assign(); err != nil {
-				p.logger.Errorf("error assigning ip: %s", err)
-			}
-		case <-p.stopC:
+		if !p.waitForReconcile(wait) {
 			return nil
 		}
+
+		err := p.reconcile()
+		if err == nil {
+			failures = 0
+			wait = interval
+			continue
+		}
+
+		class := errorClass(err)
+		if class == hcloudv1alpha1.FailurePermanent {
+			p.logger.Errorf("%s ip assigner stops retrying until the spec changes, %s error assigning ip: %s", p.fip.Name, class, err)
+			<-p.stopC
+			return nil
+		}
+
+		if needsBackoff(err) {
+			failures++
+			wait = backoffDuration(failures)
+		} else {
+			failures = 0
+			wait = interval
+		}
+		p.logger.Errorf("%s ip assigner retries in %s, %s error assigning ip: %s", p.fip.Name, wait, class, err)
+	}
+}
+
+// waitForReconcile waits for the next reconcilation and returns false if
+// the ip assigner was stopped. Triggers of changed nodes and pods end the
+// wait early, also during a backoff, so failover is never delayed.
+func (p *IPAssigner) waitForReconcile(wait time.Duration) bool {
+	select {
+	case <-p.time.After(wait):
+		return true
+	case <-p.triggerC:
+		return true
+	case <-p.stopC:
+		return false
 	}
 }
 
+// reconcile will run the assignment and write the result to the status
+// of the floating ip resource.
+func (p *IPAssigner) reconcile() error {
+	start := p.time.Now()
+	status := p.fip.Status.DeepCopy()
+	err := p.assign(status)
+
+	now := metav1.NewTime(p.time.Now())
+	p.metrics.ObserveReconcileDuration(p.fip.Name, now.Sub(start))
+	if err != nil {
+		reason := errorReason(err)
+		status.FailureClass = errorClass(err)
+		status.ConsecutiveFailures++
+		p.metrics.IncReconcileErrors(p.fip.Name, reason)
+		p.recorder.Event(p.fip, corev1.EventTypeWarning, reason, err.Error())
+		setCondition(status, hcloudv1alpha1.FloatingIPReady, corev1.ConditionFalse, reason, err.Error(), now)
+		setCondition(status, hcloudv1alpha1.FloatingIPDegraded, corev1.ConditionTrue, reason, err.Error(), now)
+	} else {
+		status.FailureClass = ""
+		status.ConsecutiveFailures = 0
+		p.metrics.SetLastSuccessfulReconcile(p.fip.Name, now.Time)
+		p.metrics.SetAssignedNodes(p.fip.Name, assignedNodes(status))
+		status.LastReconcileTime = now
+		setCondition(status, hcloudv1alpha1.FloatingIPAssigned, corev1.ConditionTrue, reasonAssigned, assignedMessage(status), now)
+		setCondition(status, hcloudv1alpha1.FloatingIPReady, corev1.ConditionTrue, reasonReconciled, "", now)
+		setCondition(status, hcloudv1alpha1.FloatingIPDegraded, corev1.ConditionFalse, reasonReconciled, "", now)
+
+		// The node is only ready once the agent configured the floating ip.
+		if p.cfg.RequireAgent {
+			confirmed, msg, cerr := p.agentConfirmed(status)
+			if cerr != nil {
+				msg = fmt.Sprintf("error checking agent confirmation: %s", cerr)
+			}
+			if !confirmed {
+				setCondition(status, hcloudv1alpha1.FloatingIPReady, corev1.ConditionFalse, reasonAwaitingAgent, msg, now)
+			}
+		}
+	}
+
+	p.mutex.Lock()
+	p.fip.Status = *status
+	p.mutex.Unlock()
+
+	if serr := p.updateStatus(status); serr != nil {
+		p.logger.Errorf("error updating status of %s: %s", p.fip.Name, serr)
+	}
+
+	return err
+}
+
+// updateStatus will write the status to the latest version of the
+// floating ip resource.
+func (p *IPAssigner) updateStatus(status *hcloudv1alpha1.FloatingIPStatus) error {
+	fip, err := p.fipCli.HcloudV1alpha1().FloatingIPs().Get(p.fip.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	fip.Status = *status
+	_, err = p.fipCli.HcloudV1alpha1().FloatingIPs().UpdateStatus(fip)
+	return err
+}
+
 // asign will verify current assignment of the floating ip and change
 // assignment to a node matching the nodeSelector in case the floating
-// ip is currently not correctly assigned
-func (p *IPAssigner) assign() error {
+// ip is currently not correctly assigned. The observed assignment is
+// written to the passed status.
+func (p *IPAssigner) assign(status *hcloudv1alpha1.FloatingIPStatus) error {
+	strategy, err := getStrategy(&p.fip.Spec)
+	if err != nil {
+		return newReconcileError(reasonInvalidSpec, err)
+	}
+
+	mode, err := referenceMode(&p.fip.Spec)
+	if err != nil {
+		return newReconcileError(reasonInvalidSpec, err)
+	}
+	if mode == referencePool || mode == referenceSelector {
+		return p.assignPool(status, strategy)
+	}
+
+	hetznerIP, err := p.findHCloudFloatingIP(status)
+	if err != nil {
+		return err
+	}
+	status.FloatingIPID = hetznerIP.ID
+	status.IP = floatingIPAddress(hetznerIP)
+	status.Family = floatingIPFamily(hetznerIP)
+
 	// Get all probable targets.
-	nodes, err := p.getProbableNodes()
+	nodes, err := p.getProbableNodes(status.Family)
 	if err != nil {
 		return err
 	}
@@ -139,79 +374,296 @@ func (p *IPAssigner) assign() error {
 	total := len(nodes.Items)
 	if total == 0 {
 		p.logger.Errorf("0 nodes probable targets")
-		return fmt.Errorf("%s ip assigner: 0 nodes probable targets", p.fip.Name)
+		return newReconcileError(reasonNoEligibleNodes, fmt.Errorf("%s ip assigner: 0 nodes probable targets", p.fip.Name))
 	}
 
-	// Get random pods.
-	target := p.getRandomNode(nodes)
-	p.logger.Infof("%s ip assigner will assign to node %s", p.fip.Name, target.Name)
+	// Check if the ip is already assigned to a valid target.
+	current, err := p.getCurrentNode(hetznerIP, nodes)
+	if err != nil {
+		return err
+	}
+	var target *corev1.Node
+	if current != nil {
+		status.NodeName = current.Name
+		status.ServerID = hetznerIP.Server.ID
+
+		// Return to a more preferred node according to the failback policy.
+		target = p.failbackTarget(current, nodes.Items)
+		if target == nil {
+			return nil
+		}
+		p.logger.Infof("%s ip assigner fails back from node %s to preferred node %s", p.fip.Name, current.Name, target.Name)
+	}
+
+	assignment := hcloudv1alpha1.FloatingIPAssignment{
+		IP:                 status.IP,
+		NodeName:           status.NodeName,
+		ServerID:           status.ServerID,
+		LastTransitionTime: status.LastTransitionTime,
+		ActionID:           status.ActionID,
+		RecentMoves:        status.RecentMoves,
+	}
 
-	// Assign
-	hetznerIP, err := p.findHCloudFloatingIP()
+	// The hysteresis may keep the ip on its node, failing back is never
+	// critical but optional.
+	held, err := p.holdFloatingIP(&assignment, hetznerIP, current != nil)
+	status.RecentMoves = assignment.RecentMoves
 	if err != nil {
 		return err
 	}
+	if held != nil {
+		status.NodeName = held.Name
+		status.ServerID = hetznerIP.Server.ID
+		return nil
+	}
 
-	server, err := p.findServer(&target)
+	// Select the target node.
+	if target == nil {
+		selected := strategy.Select(p.fip, nodes.Items, p.getNodeLoad())
+		target = &selected
+	}
+	p.logger.Infof("%s ip assigner will assign to node %s", p.fip.Name, target.Name)
+
+	err = p.moveFloatingIP(hetznerIP, target, &assignment)
+	status.NodeName = assignment.NodeName
+	status.ServerID = assignment.ServerID
+	status.LastTransitionTime = assignment.LastTransitionTime
+	status.ActionID = assignment.ActionID
+	status.RecentMoves = assignment.RecentMoves
+	return err
+}
+
+// moveFloatingIP assigns the floating ip to the server of the target node
+// and waits until the assignment finished. The action and the new node are
+// written to the assignment, the move is counted for its hysteresis.
+func (p *IPAssigner) moveFloatingIP(hetznerIP *hcloud.FloatingIP, target *corev1.Node, assignment *hcloudv1alpha1.FloatingIPAssignment) error {
+	server, err := p.findServer(target)
 	if err != nil {
 		return err
 	}
 
-	_, _, err = p.hcloudCli.FloatingIP.Assign(context.TODO(), hetznerIP, server)
+	// Never assign while the previous assignment is still in progress.
+	if err := p.checkRunningAction(assignment.ActionID); err != nil {
+		return err
+	}
+
+	action, err := p.cloudCli.AssignFloatingIP(context.TODO(), hetznerIP, server)
 	if err != nil {
+		return newReconcileError(reasonHCloudAPIError, err)
+	}
+	if action != nil {
+		assignment.ActionID = action.ID
+	}
+	if err := p.waitForAction(action, p.stopC); err != nil {
 		return err
 	}
 
-	p.logger.Infof("%s ip assigner assigned to node %s", p.fip.Name, target.Name)
+	p.logger.Infof("%s ip assigner assigned %s to node %s", p.fip.Name, assignment.IP, target.Name)
+	p.metrics.IncReassignments(p.fip.Name)
+	p.recordAssignment(assignment.IP, assignment.NodeName, target)
+	p.recordMove(assignment, assignment.NodeName, target.Name)
+	assignment.NodeName = target.Name
+	assignment.ServerID = server.ID
+	assignment.LastTransitionTime = metav1.NewTime(p.time.Now())
 	return nil
 }
 
-// Gets all the pods filtered that can be a target of termination.
-func (p *IPAssigner) getProbableNodes() (*corev1.NodeList, error) {
-	set := labels.Set(p.fip.Spec.NodeSelector)
-	slc := set.AsSelector()
-	opts := metav1.ListOptions{
-		LabelSelector: slc.String(),
+// recordAssignment emits events for the assignment of the floating ip to
+// the target node on the floating ip and the involved nodes.
+func (p *IPAssigner) recordAssignment(ip, source string, target *corev1.Node) {
+	if source == "" || source == target.Name {
+		p.recorder.Eventf(p.fip, corev1.EventTypeNormal, reasonAssigned, "assigned %s to node %s", ip, target.Name)
+	} else {
+		p.recorder.Eventf(p.fip, corev1.EventTypeNormal, reasonReassigned, "reassigned %s from node %s to node %s", ip, source, target.Name)
+		p.recorder.Eventf(nodeReference(source), corev1.EventTypeNormal, reasonFloatingIPUnassigned, "floating ip %s moved to node %s", ip, target.Name)
 	}
-	return p.k8sCli.CoreV1().Nodes().List(opts)
+	p.recorder.Eventf(nodeReference(target.Name), corev1.EventTypeNormal, reasonFloatingIPAssigned, "floating ip %s assigned to node", ip)
 }
 
-// getRandomNode will select one node randomly.
-func (p *IPAssigner) getRandomNode(nodes *corev1.NodeList) corev1.Node {
-	// Return random index.
-	items := nodes.Items
-	return items[rand.Intn(len(items))]
+// getCurrentNode returns the node the floating ip is currently assigned to.
+// If the ip is unassigned or the server does not belong to one of the
+// probable nodes nil is returned.
+func (p *IPAssigner) getCurrentNode(hetznerIP *hcloud.FloatingIP, nodes *corev1.NodeList) (*corev1.Node, error) {
+	if hetznerIP.Server == nil {
+		return nil, nil
+	}
+
+	// The server embedded in the floating ip only contains the ID, the
+	// complete server is only fetched if a node has to be matched by name.
+	var server *hcloud.Server
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if id, ok := nodeServerID(node, p.cfg.ServerIDKey); ok {
+			if id == hetznerIP.Server.ID {
+				return node, nil
+			}
+			continue
+		}
+
+		if server == nil {
+			var err error
+			server, err = p.cloudCli.ServerByID(context.TODO(), hetznerIP.Server.ID)
+			if err != nil {
+				return nil, newReconcileError(reasonHCloudAPIError, err)
+			}
+			if server == nil {
+				return nil, nil
+			}
+		}
+		if node.Name == server.Name {
+			return node, nil
+		}
+	}
+
+	return nil, nil
 }
 
-// findHCloudFloatingIP will return a hcloud FloatingIP resource that matches
-// the ip specified in the FloatingIP CRD resource
-func (p *IPAssigner) findHCloudFloatingIP() (*hcloud.FloatingIP, error) {
-	ip := net.ParseIP(p.fip.Spec.IP)
-	if ip == nil {
-		return nil, fmt.Errorf("error parsing ip from spec: %s", p.fip.Spec.IP)
+// Gets all the healthy nodes that match the node selector, run one of the
+// selected pods and pass the health check. If the agent is required only
+// nodes with an agent report are returned.
+func (p *IPAssigner) getProbableNodes(family hcloudv1alpha1.FloatingIPType) (*corev1.NodeList, error) {
+	nodes := p.listNodes(labels.Set(p.fip.Spec.NodeSelector).AsSelector())
+
+	podNodes, err := p.getPodNodes()
+	if err != nil {
+		return nil, err
 	}
 
-	fips, err := p.hcloudCli.FloatingIP.All(context.TODO())
+	healthy := nodes.Items[:0]
+	for _, node := range nodes.Items {
+		if podNodes != nil && !podNodes[node.Name] {
+			continue
+		}
+		// Nodes without an agent could never configure the floating ip.
+		if p.cfg.RequireAgent && !agent.HasReported(&node) {
+			continue
+		}
+		if isNodeHealthy(&node, p.fip.Spec.NodeHealth) {
+			healthy = append(healthy, node)
+		}
+	}
+	checked, err := p.filterHealthChecked(filterFamily(healthy, family))
 	if err != nil {
 		return nil, err
 	}
+	nodes.Items = checked
 
-	var hetznerIP *hcloud.FloatingIP
-	for i := range fips {
-		if fips[i].IP.Equal(ip) {
-			hetznerIP = fips[i]
+	return nodes, nil
+}
+
+// listNodes returns the nodes matching the selector from the shared node
+// informer. The nodes are shared and must not be modified.
+func (p *IPAssigner) listNodes(sel labels.Selector) *corev1.NodeList {
+	nodes := &corev1.NodeList{}
+	for _, obj := range p.nodes.List() {
+		node, ok := obj.(*corev1.Node)
+		if ok && sel.Matches(labels.Set(node.Labels)) {
+			nodes.Items = append(nodes.Items, *node)
 		}
 	}
+	return nodes
+}
+
+// getNode returns the node with the name from the shared node informer, nil
+// if it does not exist. The node is shared and must not be modified.
+func (p *IPAssigner) getNode(name string) (*corev1.Node, error) {
+	obj, ok, err := p.nodes.GetByKey(name)
+	if err != nil || !ok {
+		return nil, err
+	}
+	node, _ := obj.(*corev1.Node)
+	return node, nil
+}
 
-	if hetznerIP == nil {
-		return nil, fmt.Errorf("ip %s does not match any floating ip resource", ip.String())
+// getPodNodes returns the names of the nodes running a ready pod that
+// matches the pod selector. If no pod selector is set nil is returned.
+func (p *IPAssigner) getPodNodes() (map[string]bool, error) {
+	if p.fip.Spec.PodSelector == nil {
+		return nil, nil
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(p.fip.Spec.PodSelector)
+	if err != nil {
+		return nil, newReconcileError(reasonInvalidSpec, fmt.Errorf("error parsing pod selector from spec: %s", err))
 	}
 
-	return hetznerIP, nil
+	var pods []interface{}
+	if p.fip.Spec.PodNamespace != "" {
+		pods, err = p.pods.ByIndex(cache.NamespaceIndex, p.fip.Spec.PodNamespace)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		pods = p.pods.List()
+	}
+
+	podNodes := map[string]bool{}
+	for _, obj := range pods {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok || !sel.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if pod.Spec.NodeName != "" && pod.DeletionTimestamp == nil && isPodReady(pod) {
+			podNodes[pod.Spec.NodeName] = true
+		}
+	}
+	return podNodes, nil
+}
+
+// getNodeLoad returns the load of the nodes, without a loader all nodes
+// are considered empty.
+func (p *IPAssigner) getNodeLoad() Load {
+	if p.loader == nil {
+		return Load{}
+	}
+	return p.loader.NodeLoad(p.fip)
 }
 
+// findHCloudFloatingIP will return a hcloud FloatingIP resource that is
+// referenced by the FloatingIP CRD resource. If nothing is referenced the
+// floating ip created for the resource is returned and created if missing.
+func (p *IPAssigner) findHCloudFloatingIP(status *hcloudv1alpha1.FloatingIPStatus) (*hcloud.FloatingIP, error) {
+	fips, err := p.cloudCli.FloatingIPs(context.TODO())
+	if err != nil {
+		return nil, newReconcileError(reasonHCloudAPIError, err)
+	}
+
+	hetznerIP, err := p.matchFloatingIP(fips, status)
+	if err != nil {
+		return nil, err
+	}
+	if hetznerIP != nil {
+		return hetznerIP, nil
+	}
+
+	if isOperatorOwned(&p.fip.Spec) {
+		return p.allocateFloatingIP()
+	}
+
+	return nil, newReconcileError(reasonFloatingIPNotFound, fmt.Errorf("spec does not reference any floating ip resource"))
+}
+
+// findServer will return the hcloud server of the node. The server is
+// identified by the provider id of the node, the configured server id
+// label or annotation or the name of the node.
 func (p *IPAssigner) findServer(node *corev1.Node) (*hcloud.Server, error) {
-	server, _, err := p.hcloudCli.Server.GetByName(context.TODO(), node.Name)
+	if id, ok := nodeServerID(node, p.cfg.ServerIDKey); ok {
+		server, err := p.cloudCli.ServerByID(context.TODO(), id)
+		if err != nil {
+			return nil, newReconcileError(reasonHCloudAPIError, err)
+		}
+		if server == nil {
+			return nil, newReconcileError(reasonServerNotFound, fmt.Errorf("server %d of node %s does not exist", id, node.Name))
+		}
+		return server, nil
+	}
 
-	return server, err
+	server, err := p.cloudCli.ServerByName(context.TODO(), node.Name)
+	if err != nil {
+		return nil, newReconcileError(reasonHCloudAPIError, err)
+	}
+	if server == nil {
+		return nil, newReconcileError(reasonServerNotFound, fmt.Errorf("node %s has no hcloud provider id or server id and does not match any server name", node.Name))
+	}
+	return server, nil
 }
@@ -0,0 +1,464 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	floatingipfake "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned/fake"
+	cloudfake "github.com/apricote/hcloud-floating-ip-operator/pkg/cloud/fake"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/metrics"
+)
+
+func testNode(name string, serverID int, ready bool) *corev1.Node {
+	status := corev1.ConditionTrue
+	if !ready {
+		status = corev1.ConditionFalse
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.NodeSpec{ProviderID: fmt.Sprintf("%s%d", providerIDPrefix, serverID)},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: status},
+			},
+		},
+	}
+}
+
+func newPodIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+func TestIPAssignerReconcile(t *testing.T) {
+	servers := []*hcloud.Server{
+		{ID: 1, Name: "node1"},
+		{ID: 2, Name: "node2"},
+	}
+
+	tests := []struct {
+		name           string
+		nodes          []*corev1.Node
+		assignedServer int
+		errors         map[string]error
+		expErr         bool
+		expReason      string
+		expNode        string
+		expAssignments []cloudfake.Assignment
+	}{
+		{
+			name:           "Floating ip on a valid node is not moved",
+			nodes:          []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true)},
+			assignedServer: 1,
+			expNode:        "node1",
+			expAssignments: []cloudfake.Assignment{},
+		},
+		{
+			name:           "Floating ip on a not ready node is moved",
+			nodes:          []*corev1.Node{testNode("node1", 1, false), testNode("node2", 2, true)},
+			assignedServer: 1,
+			expNode:        "node2",
+			expAssignments: []cloudfake.Assignment{{FloatingIPID: 10, ServerID: 2}},
+		},
+		{
+			name:           "Unassigned floating ip is assigned",
+			nodes:          []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true)},
+			expNode:        "node1",
+			expAssignments: []cloudfake.Assignment{{FloatingIPID: 10, ServerID: 1}},
+		},
+		{
+			name:           "No eligible nodes fails",
+			nodes:          []*corev1.Node{testNode("node1", 1, false), testNode("node2", 2, false)},
+			assignedServer: 1,
+			expErr:         true,
+			expReason:      reasonNoEligibleNodes,
+			expAssignments: []cloudfake.Assignment{},
+		},
+		{
+			name:           "Missing server of the target node fails",
+			nodes:          []*corev1.Node{testNode("node1", 1, false), testNode("node3", 3, true)},
+			assignedServer: 1,
+			expErr:         true,
+			expReason:      reasonServerNotFound,
+			expAssignments: []cloudfake.Assignment{},
+		},
+		{
+			name:           "Error listing floating ips fails",
+			nodes:          []*corev1.Node{testNode("node1", 1, true)},
+			assignedServer: 1,
+			errors:         map[string]error{cloudfake.MethodFloatingIPs: errors.New("wanted error")},
+			expErr:         true,
+			expReason:      reasonHCloudAPIError,
+			expAssignments: []cloudfake.Assignment{},
+		},
+		{
+			name:           "Error getting the server fails",
+			nodes:          []*corev1.Node{testNode("node1", 1, false), testNode("node2", 2, true)},
+			assignedServer: 1,
+			errors:         map[string]error{cloudfake.MethodServerByID: errors.New("wanted error")},
+			expErr:         true,
+			expReason:      reasonHCloudAPIError,
+			expAssignments: []cloudfake.Assignment{},
+		},
+		{
+			name:           "Error assigning the floating ip fails",
+			nodes:          []*corev1.Node{testNode("node1", 1, false), testNode("node2", 2, true)},
+			assignedServer: 1,
+			errors:         map[string]error{cloudfake.MethodAssignFloatingIP: errors.New("wanted error")},
+			expErr:         true,
+			expReason:      reasonHCloudAPIError,
+			expAssignments: []cloudfake.Assignment{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hetznerIP := &hcloud.FloatingIP{ID: 10, IP: net.ParseIP("192.0.2.10"), Type: hcloud.FloatingIPTypeIPv4}
+			if test.assignedServer != 0 {
+				hetznerIP.Server = &hcloud.Server{ID: test.assignedServer}
+			}
+			cloudCli := cloudfake.NewClient([]*hcloud.FloatingIP{hetznerIP}, servers)
+			for method, err := range test.errors {
+				cloudCli.SetError(method, err)
+			}
+
+			fip := &hcloudv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: hcloudv1alpha1.FloatinIPSpec{
+					ID:       10,
+					Strategy: hcloudv1alpha1.StrategyFirstByName,
+				},
+			}
+			fipCli := floatingipfake.NewSimpleClientset(fip.DeepCopy())
+
+			nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+			for _, node := range test.nodes {
+				if err := nodes.Add(node); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p := NewIPAssigner(Config{}, fip, k8sfake.NewSimpleClientset(), fipCli, cloudCli, nodes, newPodIndexer(), record.NewFakeRecorder(100), metrics.Dummy, nil, kooperlog.Dummy)
+			err := p.reconcile()
+
+			if test.expErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				if reason := errorReason(err); reason != test.expReason {
+					t.Errorf("expected reason %s, got %s: %s", test.expReason, reason, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got := cloudCli.Assignments(); !reflect.DeepEqual(got, test.expAssignments) {
+				t.Errorf("expected assignments %v, got %v", test.expAssignments, got)
+			}
+
+			got, err := fipCli.HcloudV1alpha1().FloatingIPs().Get("test", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !test.expErr && got.Status.NodeName != test.expNode {
+				t.Errorf("expected node %s in the status, got %s", test.expNode, got.Status.NodeName)
+			}
+			ready := corev1.ConditionTrue
+			if test.expErr {
+				ready = corev1.ConditionFalse
+			}
+			if cond := findCondition(got.Status.Conditions, hcloudv1alpha1.FloatingIPReady); cond == nil || cond.Status != ready {
+				t.Errorf("expected ready condition %s, got %v", ready, cond)
+			}
+		})
+	}
+}
+
+func findCondition(conds []hcloudv1alpha1.FloatingIPCondition, condType hcloudv1alpha1.FloatingIPConditionType) *hcloudv1alpha1.FloatingIPCondition {
+	for i := range conds {
+		if conds[i].Type == condType {
+			return &conds[i]
+		}
+	}
+	return nil
+}
+
+func TestIPAssignerFindServer(t *testing.T) {
+	servers := []*hcloud.Server{
+		{ID: 1, Name: "node1"},
+		{ID: 2, Name: "server2"},
+		{ID: 3, Name: "server3"},
+	}
+
+	tests := []struct {
+		name        string
+		node        *corev1.Node
+		serverIDKey string
+		errors      map[string]error
+		expErr      bool
+		expReason   string
+		expServer   int
+	}{
+		{
+			name:      "Provider id identifies the server",
+			node:      testNode("node4", 2, true),
+			expServer: 2,
+		},
+		{
+			name: "Label identifies the server without provider id",
+			node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:   "node4",
+				Labels: map[string]string{"hcloud/server-id": "2"},
+			}},
+			serverIDKey: "hcloud/server-id",
+			expServer:   2,
+		},
+		{
+			name: "Annotation identifies the server without provider id and label",
+			node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:        "node4",
+				Annotations: map[string]string{"hcloud/server-id": "3"},
+			}},
+			serverIDKey: "hcloud/server-id",
+			expServer:   3,
+		},
+		{
+			name: "Label takes precedence over the annotation",
+			node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:        "node4",
+				Labels:      map[string]string{"hcloud/server-id": "2"},
+				Annotations: map[string]string{"hcloud/server-id": "3"},
+			}},
+			serverIDKey: "hcloud/server-id",
+			expServer:   2,
+		},
+		{
+			name: "Name identifies the server without an id",
+			node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:   "node1",
+				Labels: map[string]string{"hcloud/server-id": "2"},
+			}},
+			expServer: 1,
+		},
+		{
+			name: "Invalid id falls back to the name",
+			node: &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:   "node1",
+				Labels: map[string]string{"hcloud/server-id": "node2"},
+			}},
+			serverIDKey: "hcloud/server-id",
+			expServer:   1,
+		},
+		{
+			name:      "Missing server of the provider id fails",
+			node:      testNode("node1", 4, true),
+			expErr:    true,
+			expReason: reasonServerNotFound,
+		},
+		{
+			name:      "Node without id and matching name fails",
+			node:      &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node4"}},
+			expErr:    true,
+			expReason: reasonServerNotFound,
+		},
+		{
+			name:      "Error getting the server by name fails",
+			node:      &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+			errors:    map[string]error{cloudfake.MethodServerByName: errors.New("wanted error")},
+			expErr:    true,
+			expReason: reasonHCloudAPIError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloudCli := cloudfake.NewClient(nil, servers)
+			for method, err := range test.errors {
+				cloudCli.SetError(method, err)
+			}
+			p := &IPAssigner{cfg: Config{ServerIDKey: test.serverIDKey}, cloudCli: cloudCli}
+
+			server, err := p.findServer(test.node)
+
+			if test.expErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				if reason := errorReason(err); reason != test.expReason {
+					t.Errorf("expected reason %s, got %s: %s", test.expReason, reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if server.ID != test.expServer {
+				t.Errorf("expected server %d, got %d", test.expServer, server.ID)
+			}
+		})
+	}
+}
+
+func TestIPAssignerFindHCloudFloatingIP(t *testing.T) {
+	fips := []*hcloud.FloatingIP{
+		{ID: 10, IP: net.ParseIP("192.0.2.10"), Type: hcloud.FloatingIPTypeIPv4},
+		{ID: 11, IP: net.ParseIP("2001:db8:1::"), Type: hcloud.FloatingIPTypeIPv6},
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		expErr    bool
+		expReason string
+		expID     int
+	}{
+		{
+			name:  "IPv4 address matches",
+			ip:    "192.0.2.10",
+			expID: 10,
+		},
+		{
+			name:  "IPv6 prefix matches",
+			ip:    "2001:db8:1::/64",
+			expID: 11,
+		},
+		{
+			name:  "IPv6 address in the prefix matches",
+			ip:    "2001:db8:1::1",
+			expID: 11,
+		},
+		{
+			name:      "Longer IPv6 network does not match",
+			ip:        "2001:db8::/48",
+			expErr:    true,
+			expReason: reasonFloatingIPNotFound,
+		},
+		{
+			name:      "Unknown ip fails",
+			ip:        "192.0.2.11",
+			expErr:    true,
+			expReason: reasonFloatingIPNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fip := &hcloudv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec:       hcloudv1alpha1.FloatinIPSpec{IP: test.ip},
+			}
+			p := &IPAssigner{fip: fip, cloudCli: cloudfake.NewClient(fips, nil)}
+
+			hetznerIP, err := p.findHCloudFloatingIP(&hcloudv1alpha1.FloatingIPStatus{})
+
+			if test.expErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				if reason := errorReason(err); reason != test.expReason {
+					t.Errorf("expected reason %s, got %s: %s", test.expReason, reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if hetznerIP.ID != test.expID {
+				t.Errorf("expected floating ip %d, got %d", test.expID, hetznerIP.ID)
+			}
+		})
+	}
+}
+
+func TestIPAssignerGetPodNodes(t *testing.T) {
+	testPod := func(namespace, name, node string, ready bool, labels map[string]string) *corev1.Pod {
+		status := corev1.ConditionTrue
+		if !ready {
+			status = corev1.ConditionFalse
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: status},
+				},
+			},
+		}
+	}
+	web := map[string]string{"app": "web"}
+	pods := []*corev1.Pod{
+		testPod("default", "web1", "node1", true, web),
+		testPod("default", "web2", "node2", false, web),
+		testPod("default", "db1", "node3", true, map[string]string{"app": "db"}),
+		testPod("other", "web3", "node4", true, web),
+		testPod("other", "web4", "", true, web),
+	}
+
+	tests := []struct {
+		name      string
+		selector  *metav1.LabelSelector
+		namespace string
+		expNodes  map[string]bool
+	}{
+		{
+			name:     "Without pod selector all nodes are allowed",
+			expNodes: nil,
+		},
+		{
+			name:     "Nodes of ready pods in all namespaces are selected",
+			selector: &metav1.LabelSelector{MatchLabels: web},
+			expNodes: map[string]bool{"node1": true, "node4": true},
+		},
+		{
+			name:      "Nodes of ready pods in the namespace are selected",
+			selector:  &metav1.LabelSelector{MatchLabels: web},
+			namespace: "default",
+			expNodes:  map[string]bool{"node1": true},
+		},
+		{
+			name:      "No matching pods select no nodes",
+			selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cache"}},
+			namespace: "default",
+			expNodes:  map[string]bool{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			indexer := newPodIndexer()
+			for _, pod := range pods {
+				if err := indexer.Add(pod); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fip := &hcloudv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: hcloudv1alpha1.FloatinIPSpec{
+					PodSelector:  test.selector,
+					PodNamespace: test.namespace,
+				},
+			}
+			p := &IPAssigner{fip: fip, pods: indexer}
+
+			got, err := p.getPodNodes()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, test.expNodes) {
+				t.Errorf("expected nodes %v, got %v", test.expNodes, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	corev1 "k8s.io/api/core/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+// assignPool will verify the assignment of every floating ip of the pool
+// and reassign the floating ips that are not on a valid target according
+// to the distribution policy. The observed assignments are written to the
+// passed status.
+func (p *IPAssigner) assignPool(status *hcloudv1alpha1.FloatingIPStatus, strategy Strategy) error {
+	pool, refs, err := p.findPoolFloatingIPs()
+	if err != nil {
+		return err
+	}
+
+	nodes, err := p.getProbableNodes("")
+	if err != nil {
+		return err
+	}
+	if len(nodes.Items) == 0 {
+		p.logger.Errorf("0 nodes probable targets")
+		return newReconcileError(reasonNoEligibleNodes, fmt.Errorf("%s ip assigner: 0 nodes probable targets", p.fip.Name))
+	}
+
+	previous := map[string]hcloudv1alpha1.FloatingIPAssignment{}
+	for _, a := range status.IPs {
+		previous[a.Reference] = a
+	}
+
+	spread := p.fip.Spec.Distribution == hcloudv1alpha1.DistributionSpread
+	candidates := make([][]corev1.Node, len(pool))
+	families := map[hcloudv1alpha1.FloatingIPType]bool{}
+	for _, hetznerIP := range pool {
+		families[floatingIPFamily(hetznerIP)] = true
+	}
+	for i, hetznerIP := range pool {
+		if spread {
+			candidates[i] = filterFamily(nodes.Items, floatingIPFamily(hetznerIP))
+			continue
+		}
+		// Colocated floating ips need a node that supports all families.
+		candidates[i] = nodes.Items
+		for family := range families {
+			candidates[i] = filterFamily(candidates[i], family)
+		}
+	}
+
+	// More floating ips than nodes have to share nodes when spreading.
+	perNode := (len(pool) + len(nodes.Items) - 1) / len(nodes.Items)
+
+	assignments := make([]hcloudv1alpha1.FloatingIPAssignment, len(pool))
+	currents := make([]*corev1.Node, len(pool))
+	counts := map[string]int{}
+	colocated := ""
+	pending := []int{}
+	var firstErr error
+
+	// Keep the floating ips that are already on a valid target.
+	for i, hetznerIP := range pool {
+		a := previous[refs[i]]
+		a.Reference = refs[i]
+		a.FloatingIPID = hetznerIP.ID
+		a.IP = floatingIPAddress(hetznerIP)
+		a.Family = floatingIPFamily(hetznerIP)
+		assignments[i] = a
+
+		current, err := p.getCurrentNode(hetznerIP, &corev1.NodeList{Items: candidates[i]})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		currents[i] = current
+		keep := current != nil
+		if keep && spread {
+			keep = counts[current.Name] < perNode
+		}
+		if keep && !spread {
+			keep = colocated == "" || colocated == current.Name
+		}
+		if !keep {
+			pending = append(pending, i)
+			continue
+		}
+
+		counts[current.Name]++
+		if !spread {
+			colocated = current.Name
+		}
+		assignments[i].NodeName = current.Name
+		assignments[i].ServerID = hetznerIP.Server.ID
+	}
+
+	// Move the remaining floating ips.
+	for _, i := range pending {
+		// The hysteresis may keep the ip on a node that is no probable
+		// target. Rebalancing an ip that is on a valid target is optional.
+		held, err := p.holdFloatingIP(&assignments[i], pool[i], currents[i] != nil)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if held != nil {
+			counts[held.Name]++
+			assignments[i].NodeName = held.Name
+			assignments[i].ServerID = pool[i].Server.ID
+			continue
+		}
+
+		target, err := p.selectPoolTarget(strategy, candidates[i], counts, colocated)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if err := p.moveFloatingIP(pool[i], target, &assignments[i]); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		counts[target.Name]++
+		if !spread {
+			colocated = target.Name
+		}
+	}
+
+	status.IPs = assignments
+	status.RecentMoves = nil
+	status.NodeName = colocated
+	status.ServerID = 0
+	for _, a := range assignments {
+		if a.NodeName == colocated && colocated != "" {
+			status.ServerID = a.ServerID
+			break
+		}
+	}
+
+	return firstErr
+}
+
+// selectPoolTarget returns the node a floating ip of the pool is moved to.
+// Colocated floating ips follow the node of the pool, spread floating ips
+// go to the candidates with the fewest floating ips of the pool.
+func (p *IPAssigner) selectPoolTarget(strategy Strategy, candidates []corev1.Node, counts map[string]int, colocated string) (*corev1.Node, error) {
+	if len(candidates) == 0 {
+		return nil, newReconcileError(reasonNoEligibleNodes, fmt.Errorf("%s ip assigner: 0 nodes probable targets for the address family", p.fip.Name))
+	}
+
+	if colocated != "" {
+		for i := range candidates {
+			if candidates[i].Name == colocated {
+				return &candidates[i], nil
+			}
+		}
+		return nil, newReconcileError(reasonNoEligibleNodes, fmt.Errorf("%s ip assigner: node %s is no probable target for the address family", p.fip.Name, colocated))
+	}
+
+	least := []corev1.Node{}
+	fewest := -1
+	for _, node := range candidates {
+		count := counts[node.Name]
+		if fewest == -1 || count < fewest {
+			fewest = count
+			least = least[:0]
+		}
+		if count == fewest {
+			least = append(least, node)
+		}
+	}
+
+	target := strategy.Select(p.fip, least, p.getNodeLoad())
+	return &target, nil
+}
+
+// findPoolFloatingIPs returns the hcloud floating ips of the pool and the
+// references they are tracked by in the status.
+func (p *IPAssigner) findPoolFloatingIPs() ([]*hcloud.FloatingIP, []string, error) {
+	fips, err := p.cloudCli.FloatingIPs(context.TODO())
+	if err != nil {
+		return nil, nil, newReconcileError(reasonHCloudAPIError, err)
+	}
+
+	pool, refs, err := matchPoolSpec(fips, &p.fip.Spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pool) == 0 {
+		return nil, nil, newReconcileError(reasonFloatingIPNotFound, fmt.Errorf("selector does not match any floating ip resource"))
+	}
+	return pool, refs, nil
+}
+
+// matchPoolSpec returns the hcloud floating ips of the pool of the spec
+// and their references. The ips of the spec are their own references, the
+// floating ips matching a selector are ordered by id and referenced by
+// their address.
+func matchPoolSpec(fips []*hcloud.FloatingIP, spec *hcloudv1alpha1.FloatinIPSpec) ([]*hcloud.FloatingIP, []string, error) {
+	if spec.Selector == nil {
+		pool, err := matchPool(fips, spec.IPs)
+		return pool, spec.IPs, err
+	}
+
+	pool, err := matchSelector(fips, spec.Selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	refs := make([]string, len(pool))
+	for i, fip := range pool {
+		refs[i] = floatingIPAddress(fip)
+	}
+	return pool, refs, nil
+}
+
+// matchPool returns the hcloud floating ips matching the ips of a pool.
+func matchPool(fips []*hcloud.FloatingIP, ips []string) ([]*hcloud.FloatingIP, error) {
+	pool := make([]*hcloud.FloatingIP, 0, len(ips))
+	for _, ip := range ips {
+		network, err := parseSpecIP(ip)
+		if err != nil {
+			return nil, newReconcileError(reasonInvalidSpec, fmt.Errorf("error parsing ip of the pool: %s", err))
+		}
+
+		var match *hcloud.FloatingIP
+		for _, fip := range fips {
+			if matchesNetwork(fip, network) {
+				match = fip
+				break
+			}
+		}
+		if match == nil {
+			return nil, newReconcileError(reasonFloatingIPNotFound, fmt.Errorf("ip %s of the pool does not match any floating ip resource", ip))
+		}
+		pool = append(pool, match)
+	}
+	return pool, nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	kooperlog "github.com/spotahome/kooper/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	floatingipfake "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned/fake"
+	cloudfake "github.com/apricote/hcloud-floating-ip-operator/pkg/cloud/fake"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/metrics"
+)
+
+func TestIPAssignerAssignPool(t *testing.T) {
+	servers := []*hcloud.Server{
+		{ID: 1, Name: "node1"},
+		{ID: 2, Name: "node2"},
+		{ID: 3, Name: "node3"},
+	}
+	ipv4 := func(id, serverID int) *hcloud.FloatingIP {
+		fip := &hcloud.FloatingIP{ID: id, IP: net.IPv4(192, 0, 2, byte(id)), Type: hcloud.FloatingIPTypeIPv4}
+		if serverID != 0 {
+			fip.Server = &hcloud.Server{ID: serverID}
+		}
+		return fip
+	}
+	ipv6 := func(id, serverID int) *hcloud.FloatingIP {
+		fip := &hcloud.FloatingIP{ID: id, IP: net.ParseIP("2001:db8:1::"), Network: &net.IPNet{IP: net.ParseIP("2001:db8:1::"), Mask: net.CIDRMask(64, 128)}, Type: hcloud.FloatingIPTypeIPv6}
+		if serverID != 0 {
+			fip.Server = &hcloud.Server{ID: serverID}
+		}
+		return fip
+	}
+
+	tests := []struct {
+		name         string
+		distribution hcloudv1alpha1.DistributionPolicy
+		nodes        []*corev1.Node
+		fips         []*hcloud.FloatingIP
+		ips          []string
+		expNodes     map[string]string
+		expNode      string
+	}{
+		{
+			name:     "Colocated floating ips are assigned to one node",
+			nodes:    []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true)},
+			fips:     []*hcloud.FloatingIP{ipv4(10, 0), ipv4(11, 0)},
+			ips:      []string{"192.0.2.10", "192.0.2.11"},
+			expNodes: map[string]string{"192.0.2.10": "node1", "192.0.2.11": "node1"},
+			expNode:  "node1",
+		},
+		{
+			name:     "Colocated floating ips follow the first assigned floating ip",
+			nodes:    []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true)},
+			fips:     []*hcloud.FloatingIP{ipv4(10, 2), ipv4(11, 0)},
+			ips:      []string{"192.0.2.10", "192.0.2.11"},
+			expNodes: map[string]string{"192.0.2.10": "node2", "192.0.2.11": "node2"},
+			expNode:  "node2",
+		},
+		{
+			name:     "Colocated floating ips on different nodes are moved together",
+			nodes:    []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true)},
+			fips:     []*hcloud.FloatingIP{ipv4(10, 1), ipv4(11, 2)},
+			ips:      []string{"192.0.2.10", "192.0.2.11"},
+			expNodes: map[string]string{"192.0.2.10": "node1", "192.0.2.11": "node1"},
+			expNode:  "node1",
+		},
+		{
+			name:     "Colocated floating ips are assigned to a node supporting all families",
+			nodes:    []*corev1.Node{testNode("node1", 1, true), withIPv6(testNode("node2", 2, true))},
+			fips:     []*hcloud.FloatingIP{ipv4(10, 1), ipv6(11, 0)},
+			ips:      []string{"192.0.2.10", "2001:db8:1::"},
+			expNodes: map[string]string{"192.0.2.10": "node2", "2001:db8:1::/64": "node2"},
+			expNode:  "node2",
+		},
+		{
+			name:         "Spread floating ips are assigned to different nodes",
+			distribution: hcloudv1alpha1.DistributionSpread,
+			nodes:        []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true), testNode("node3", 3, true)},
+			fips:         []*hcloud.FloatingIP{ipv4(10, 0), ipv4(11, 0)},
+			ips:          []string{"192.0.2.10", "192.0.2.11"},
+			expNodes:     map[string]string{"192.0.2.10": "node1", "192.0.2.11": "node2"},
+		},
+		{
+			name:         "Spread floating ips on the same node are distributed",
+			distribution: hcloudv1alpha1.DistributionSpread,
+			nodes:        []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true), testNode("node3", 3, true)},
+			fips:         []*hcloud.FloatingIP{ipv4(10, 3), ipv4(11, 3)},
+			ips:          []string{"192.0.2.10", "192.0.2.11"},
+			expNodes:     map[string]string{"192.0.2.10": "node3", "192.0.2.11": "node1"},
+		},
+		{
+			name:         "Spread floating ips share nodes evenly",
+			distribution: hcloudv1alpha1.DistributionSpread,
+			nodes:        []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true)},
+			fips:         []*hcloud.FloatingIP{ipv4(10, 0), ipv4(11, 0), ipv4(12, 0)},
+			ips:          []string{"192.0.2.10", "192.0.2.11", "192.0.2.12"},
+			expNodes:     map[string]string{"192.0.2.10": "node1", "192.0.2.11": "node2", "192.0.2.12": "node1"},
+		},
+		{
+			name:         "Spread floating ips on a lost node are moved to the node with the fewest",
+			distribution: hcloudv1alpha1.DistributionSpread,
+			nodes:        []*corev1.Node{testNode("node1", 1, true), testNode("node2", 2, true), testNode("node3", 3, false)},
+			fips:         []*hcloud.FloatingIP{ipv4(10, 1), ipv4(11, 3)},
+			ips:          []string{"192.0.2.10", "192.0.2.11"},
+			expNodes:     map[string]string{"192.0.2.10": "node1", "192.0.2.11": "node2"},
+		},
+		{
+			name:         "Spread floating ips are only assigned to nodes of their family",
+			distribution: hcloudv1alpha1.DistributionSpread,
+			nodes:        []*corev1.Node{testNode("node1", 1, true), withIPv6(testNode("node2", 2, true))},
+			fips:         []*hcloud.FloatingIP{ipv6(10, 0), ipv4(11, 0)},
+			ips:          []string{"2001:db8:1::", "192.0.2.11"},
+			expNodes:     map[string]string{"2001:db8:1::/64": "node2", "192.0.2.11": "node1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cloudCli := cloudfake.NewClient(test.fips, servers)
+			nodes := cache.NewStore(cache.MetaNamespaceKeyFunc)
+			for _, node := range test.nodes {
+				if err := nodes.Add(node); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			fip := &hcloudv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec: hcloudv1alpha1.FloatinIPSpec{
+					IPs:          test.ips,
+					Distribution: test.distribution,
+					Strategy:     hcloudv1alpha1.StrategyFirstByName,
+				},
+			}
+			fipCli := floatingipfake.NewSimpleClientset(fip.DeepCopy())
+
+			p := NewCustomIPAssigner(Config{}, fip, k8sfake.NewSimpleClientset(), fipCli, cloudCli, nodes, newPodIndexer(), record.NewFakeRecorder(100), metrics.Dummy, nil, newFakeTime(), kooperlog.Dummy)
+			if err := p.reconcile(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			got, err := fipCli.HcloudV1alpha1().FloatingIPs().Get("test", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nodes := assignedNodes(&got.Status); !reflect.DeepEqual(nodes, test.expNodes) {
+				t.Errorf("expected assigned nodes %v, got %v", test.expNodes, nodes)
+			}
+			if got.Status.NodeName != test.expNode {
+				t.Errorf("expected node %q in the status, got %q", test.expNode, got.Status.NodeName)
+			}
+		})
+	}
+}
+
+func withIPv6(node *corev1.Node) *corev1.Node {
+	node.Labels = map[string]string{ipv6Label: "true"}
+	return node
+}
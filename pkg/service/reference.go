@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+// Ways the spec can reference the hcloud floating ip.
+const (
+	referenceNone     = ""
+	referenceIP       = "IP"
+	referenceID       = "id"
+	referenceName     = "name"
+	referenceSelector = "selector"
+	referencePool     = "ips"
+)
+
+// referenceMode returns how the spec references the hcloud floating ip. If
+// no reference is set the floating ip is created by the operator.
+func referenceMode(spec *hcloudv1alpha1.FloatinIPSpec) (string, error) {
+	modes := []string{}
+	if spec.IP != "" {
+		modes = append(modes, referenceIP)
+	}
+	if spec.ID != 0 {
+		modes = append(modes, referenceID)
+	}
+	if spec.Name != "" {
+		modes = append(modes, referenceName)
+	}
+	if spec.Selector != nil {
+		modes = append(modes, referenceSelector)
+	}
+	if len(spec.IPs) > 0 {
+		modes = append(modes, referencePool)
+	}
+
+	switch len(modes) {
+	case 0:
+		return referenceNone, nil
+	case 1:
+		return modes[0], nil
+	default:
+		return "", fmt.Errorf("only one of IP, ips, id, name and selector can be set, got %s", strings.Join(modes, ", "))
+	}
+}
+
+// isOperatorOwned checks if the floating ip of the spec is created by the
+// operator.
+func isOperatorOwned(spec *hcloudv1alpha1.FloatinIPSpec) bool {
+	mode, err := referenceMode(spec)
+	return err == nil && mode == referenceNone
+}
+
+// isPool checks if the spec references a pool of floating ips, either by
+// their ips or by a selector.
+func isPool(spec *hcloudv1alpha1.FloatinIPSpec) bool {
+	mode, err := referenceMode(spec)
+	return err == nil && (mode == referencePool || mode == referenceSelector)
+}
+
+// matchFloatingIP returns the floating ip of the resource out of the hcloud
+// floating ips or nil if it does not exist.
+func (p *IPAssigner) matchFloatingIP(fips []*hcloud.FloatingIP, status *hcloudv1alpha1.FloatingIPStatus) (*hcloud.FloatingIP, error) {
+	mode, err := referenceMode(&p.fip.Spec)
+	if err != nil {
+		return nil, newReconcileError(reasonInvalidSpec, err)
+	}
+
+	switch mode {
+	case referenceIP:
+		network, err := parseSpecIP(p.fip.Spec.IP)
+		if err != nil {
+			return nil, newReconcileError(reasonInvalidSpec, fmt.Errorf("error parsing ip from spec: %s", err))
+		}
+		for _, fip := range fips {
+			if matchesNetwork(fip, network) {
+				return fip, nil
+			}
+		}
+		return nil, nil
+	case referenceID:
+		for _, fip := range fips {
+			if fip.ID == p.fip.Spec.ID {
+				return fip, nil
+			}
+		}
+		return nil, nil
+	case referenceName:
+		return matchFloatingIPByName(fips, p.fip.Spec.Name)
+	case referencePool, referenceSelector:
+		return nil, newReconcileError(reasonInvalidSpec, fmt.Errorf("a pool references more than one floating ip"))
+	default:
+		return p.findOwnedFloatingIP(fips, status), nil
+	}
+}
+
+// matchFloatingIPByName returns the floating ip with the name. The hcloud api
+// has no names for floating ips, so the name is matched against the
+// description. Multiple matches are reported as ambiguous.
+func matchFloatingIPByName(fips []*hcloud.FloatingIP, name string) (*hcloud.FloatingIP, error) {
+	var match *hcloud.FloatingIP
+	for _, fip := range fips {
+		if fip.Description != name {
+			continue
+		}
+		if match != nil {
+			return nil, newReconcileError(reasonAmbiguousReference, fmt.Errorf("name %s matches floating ips %d and %d", name, match.ID, fip.ID))
+		}
+		match = fip
+	}
+	return match, nil
+}
+
+// matchSelector returns all floating ips whose labels match the selector
+// ordered by id.
+func matchSelector(fips []*hcloud.FloatingIP, selector *metav1.LabelSelector) ([]*hcloud.FloatingIP, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, newReconcileError(reasonInvalidSpec, fmt.Errorf("error parsing selector from spec: %s", err))
+	}
+
+	matches := []*hcloud.FloatingIP{}
+	for _, fip := range fips {
+		if sel.Matches(labels.Set(fip.Labels)) {
+			matches = append(matches, fip)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return matches, nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/hcloud"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+func testFloatingIPs() []*hcloud.FloatingIP {
+	return []*hcloud.FloatingIP{
+		{ID: 11, IP: net.ParseIP("192.0.2.11"), Type: hcloud.FloatingIPTypeIPv4, Description: "db", Labels: map[string]string{"role": "web"}},
+		{ID: 10, IP: net.ParseIP("192.0.2.10"), Type: hcloud.FloatingIPTypeIPv4, Description: "web", Labels: map[string]string{"role": "web"}},
+		{ID: 12, IP: net.ParseIP("2001:db8:1::"), Type: hcloud.FloatingIPTypeIPv6, Description: "db", Labels: map[string]string{"role": "db"}},
+	}
+}
+
+func TestMatchFloatingIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      hcloudv1alpha1.FloatinIPSpec
+		expErr    bool
+		expReason string
+		expID     int
+	}{
+		{
+			name:  "IPv4 address matches the floating ip",
+			spec:  hcloudv1alpha1.FloatinIPSpec{IP: "192.0.2.10"},
+			expID: 10,
+		},
+		{
+			name:  "IPv6 prefix matches the floating ip",
+			spec:  hcloudv1alpha1.FloatinIPSpec{IP: "2001:db8:1::/64"},
+			expID: 12,
+		},
+		{
+			name:  "IPv6 address in the prefix matches the floating ip",
+			spec:  hcloudv1alpha1.FloatinIPSpec{IP: "2001:db8:1::1"},
+			expID: 12,
+		},
+		{
+			name: "Unknown ip matches nothing",
+			spec: hcloudv1alpha1.FloatinIPSpec{IP: "192.0.2.99"},
+		},
+		{
+			name:      "Invalid ip fails",
+			spec:      hcloudv1alpha1.FloatinIPSpec{IP: "192.0.2"},
+			expErr:    true,
+			expReason: reasonInvalidSpec,
+		},
+		{
+			name:  "ID matches the floating ip",
+			spec:  hcloudv1alpha1.FloatinIPSpec{ID: 11},
+			expID: 11,
+		},
+		{
+			name: "Unknown id matches nothing",
+			spec: hcloudv1alpha1.FloatinIPSpec{ID: 99},
+		},
+		{
+			name:  "Name matches the description of the floating ip",
+			spec:  hcloudv1alpha1.FloatinIPSpec{Name: "web"},
+			expID: 10,
+		},
+		{
+			name:      "Name matching several floating ips is ambiguous",
+			spec:      hcloudv1alpha1.FloatinIPSpec{Name: "db"},
+			expErr:    true,
+			expReason: reasonAmbiguousReference,
+		},
+		{
+			name:      "Selector is a pool",
+			spec:      hcloudv1alpha1.FloatinIPSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "web"}}},
+			expErr:    true,
+			expReason: reasonInvalidSpec,
+		},
+		{
+			name:      "Several references fail",
+			spec:      hcloudv1alpha1.FloatinIPSpec{ID: 10, Name: "web"},
+			expErr:    true,
+			expReason: reasonInvalidSpec,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &IPAssigner{fip: &hcloudv1alpha1.FloatingIP{Spec: test.spec}}
+			fip, err := p.matchFloatingIP(testFloatingIPs(), &hcloudv1alpha1.FloatingIPStatus{})
+
+			if test.expErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				if reason := errorReason(err); reason != test.expReason {
+					t.Errorf("expected reason %s, got %s: %s", test.expReason, reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if test.expID == 0 {
+				if fip != nil {
+					t.Errorf("expected no floating ip, got %d", fip.ID)
+				}
+				return
+			}
+			if fip == nil || fip.ID != test.expID {
+				t.Errorf("expected floating ip %d, got %v", test.expID, fip)
+			}
+		})
+	}
+}
+
+func TestMatchPoolSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      hcloudv1alpha1.FloatinIPSpec
+		expErr    bool
+		expReason string
+		expIDs    []int
+		expRefs   []string
+	}{
+		{
+			name:    "IPs are matched in the order of the spec",
+			spec:    hcloudv1alpha1.FloatinIPSpec{IPs: []string{"2001:db8:1::/64", "192.0.2.10"}},
+			expIDs:  []int{12, 10},
+			expRefs: []string{"2001:db8:1::/64", "192.0.2.10"},
+		},
+		{
+			name:      "Unknown ip of the pool fails",
+			spec:      hcloudv1alpha1.FloatinIPSpec{IPs: []string{"192.0.2.10", "192.0.2.99"}},
+			expErr:    true,
+			expReason: reasonFloatingIPNotFound,
+		},
+		{
+			name:    "Selector matches all floating ips ordered by id",
+			spec:    hcloudv1alpha1.FloatinIPSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "web"}}},
+			expIDs:  []int{10, 11},
+			expRefs: []string{"192.0.2.10", "192.0.2.11"},
+		},
+		{
+			name:    "Selector references ipv6 floating ips by their prefix",
+			spec:    hcloudv1alpha1.FloatinIPSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "db"}}},
+			expIDs:  []int{12},
+			expRefs: []string{"2001:db8:1::/64"},
+		},
+		{
+			name:    "Selector matching nothing is empty",
+			spec:    hcloudv1alpha1.FloatinIPSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "cache"}}},
+			expIDs:  []int{},
+			expRefs: []string{},
+		},
+		{
+			name: "Invalid selector fails",
+			spec: hcloudv1alpha1.FloatinIPSpec{Selector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "role", Operator: "Like"}},
+			}},
+			expErr:    true,
+			expReason: reasonInvalidSpec,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, refs, err := matchPoolSpec(testFloatingIPs(), &test.spec)
+
+			if test.expErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				if reason := errorReason(err); reason != test.expReason {
+					t.Errorf("expected reason %s, got %s: %s", test.expReason, reason, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			ids := []int{}
+			for _, fip := range pool {
+				ids = append(ids, fip.ID)
+			}
+			if !reflect.DeepEqual(ids, test.expIDs) {
+				t.Errorf("expected floating ips %v, got %v", test.expIDs, ids)
+			}
+			if !reflect.DeepEqual(refs, test.expRefs) {
+				t.Errorf("expected references %v, got %v", test.expRefs, refs)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// providerIDPrefix is the prefix of provider ids set by the hcloud cloud
+	// controller manager.
+	providerIDPrefix = "hcloud://"
+)
+
+// nodeServerID returns the id of the hcloud server of the node. The id is
+// read from the provider id of the node and if that is not set from the
+// label or annotation with the key. The second return value is false if
+// no id could be found.
+func nodeServerID(node *corev1.Node, key string) (int, bool) {
+	if strings.HasPrefix(node.Spec.ProviderID, providerIDPrefix) {
+		if id, err := strconv.Atoi(strings.TrimPrefix(node.Spec.ProviderID, providerIDPrefix)); err == nil {
+			return id, true
+		}
+	}
+
+	if key == "" {
+		return 0, false
+	}
+
+	value, ok := node.Labels[key]
+	if !ok {
+		value, ok = node.Annotations[key]
+	}
+	if !ok {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
@@ -1,13 +1,25 @@
 package service
 
 import (
+	"fmt"
+	"reflect"
 	"sync"
+	"time"
 
-	"github.com/hetznercloud/hcloud-go/hcloud"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 
+	hcloudfloatingipoperator "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud"
 	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+	floatingipk8scli "github.com/apricote/hcloud-floating-ip-operator/client/k8s/clientset/versioned"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/cloud"
 	"github.com/apricote/hcloud-floating-ip-operator/pkg/log"
+	"github.com/apricote/hcloud-floating-ip-operator/pkg/metrics"
 )
 
 type Syncer interface {
@@ -18,24 +30,220 @@ type Syncer interface {
 // Service is the service that will ensure that the desired floating ip CRDs are met.
 // Service will have running instances of IPAssigners.
 type Service struct {
-	k8sCli    kubernetes.Interface
-	hcloudCli *hcloud.Client
-	reg       sync.Map
-	logger    log.Logger
+	cfg      Config
+	k8sCli   kubernetes.Interface
+	fipCli   floatingipk8scli.Interface
+	cloudCli cloud.Client
+	recorder record.EventRecorder
+	metrics  metrics.Recorder
+	reg      sync.Map
+	logger   log.Logger
+
+	nodeInformer cache.SharedIndexInformer
+	podInformer  cache.SharedIndexInformer
+
+	// The pod informer is only started once a floating ip selects pods.
+	stopC      <-chan struct{}
+	podMutex   sync.Mutex
+	podRunning bool
 }
 
 // NewService returns a new floating ip assigner service.
-func NewService(k8sCli kubernetes.Interface, hcloudCli *hcloud.Client, logger log.Logger) *Service {
-	return &Service{
-		k8sCli:    k8sCli,
-		hcloudCli: hcloudCli,
-		reg:       sync.Map{},
-		logger:    logger,
+func NewService(cfg Config, k8sCli kubernetes.Interface, fipCli floatingipk8scli.Interface, cloudCli cloud.Client, recorder record.EventRecorder, metricsRec metrics.Recorder, logger log.Logger) *Service {
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = time.Duration(MinimalIntervalSeconds) * time.Second
+	}
+
+	s := &Service{
+		cfg:      cfg,
+		k8sCli:   k8sCli,
+		fipCli:   fipCli,
+		cloudCli: newCachedClient(cloudCli, ttl, &timeStd{}),
+		recorder: recorder,
+		metrics:  metricsRec,
+		reg:      sync.Map{},
+		logger:   logger,
+	}
+
+	s.nodeInformer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return k8sCli.CoreV1().Nodes().List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return k8sCli.CoreV1().Nodes().Watch(options)
+			},
+		},
+		&corev1.Node{},
+		0,
+		cache.Indexers{},
+	)
+	s.nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, obj interface{}) {
+			node, ok := obj.(*corev1.Node)
+			if !ok {
+				return
+			}
+			s.handleNodeChange(node, false)
+			if oldNode, ok := oldObj.(*corev1.Node); ok && s.cfg.RequireAgent {
+				s.handleAgentReport(oldNode, node)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*corev1.Node); ok {
+				s.handleNodeChange(node, true)
+			}
+		},
+	})
+
+	s.podInformer = cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return k8sCli.CoreV1().Pods(metav1.NamespaceAll).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return k8sCli.CoreV1().Pods(metav1.NamespaceAll).Watch(options)
+			},
+		},
+		&corev1.Pod{},
+		0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+	s.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				s.handlePodChange(nil, pod)
+			}
+		},
+		UpdateFunc: func(oldObj, obj interface{}) {
+			oldPod, ok := oldObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				s.handlePodChange(oldPod, pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				s.handlePodChange(pod, nil)
+			}
+		},
+	})
+
+	return s
+}
+
+// Run starts the node informer of the service and waits until it is
+// synced. The pod informer is started when it is first needed.
+func (c *Service) Run(stopC <-chan struct{}) error {
+	c.stopC = stopC
+	go c.nodeInformer.Run(stopC)
+
+	if !cache.WaitForCacheSync(stopC, c.nodeInformer.HasSynced) {
+		return fmt.Errorf("timed out waiting for informers to sync")
 	}
+	return nil
+}
+
+// runPodInformer starts the pod informer the first time a floating ip
+// selects pods and waits until it is synced. Without pod selectors the
+// pods of the cluster are never watched.
+func (c *Service) runPodInformer() error {
+	c.podMutex.Lock()
+	if !c.podRunning {
+		c.podRunning = true
+		c.logger.Infof("floating ips select pods, starting pod informer")
+		go c.podInformer.Run(c.stopC)
+	}
+	c.podMutex.Unlock()
+
+	if !cache.WaitForCacheSync(c.stopC, c.podInformer.HasSynced) {
+		return fmt.Errorf("timed out waiting for pod informer to sync")
+	}
+	return nil
+}
+
+// handleNodeChange will trigger an immediate reconcilation of all ip
+// assigners whose floating ip is assigned to the node if the node is no
+// longer a valid target.
+func (c *Service) handleNodeChange(node *corev1.Node, deleted bool) {
+	c.reg.Range(func(_, v interface{}) bool {
+		ipa := v.(*IPAssigner)
+		if !ipa.IsAssignedTo(node.Name) {
+			return true
+		}
+
+		if deleted || !ipa.IsTarget(node) {
+			c.logger.Infof("node %s of %s is no longer a valid target, reconciling", node.Name, ipa.fip.Name)
+			ipa.Trigger()
+		}
+		return true
+	})
+}
+
+// handleAgentReport will trigger an immediate reconcilation of all ip
+// assigners whose floating ip is assigned to the node if the agent reported
+// a change of the configured floating ips.
+func (c *Service) handleAgentReport(oldNode, node *corev1.Node) {
+	key := hcloudfloatingipoperator.ConfiguredFloatingIPsAnnotation
+	if oldNode.Annotations[key] == node.Annotations[key] {
+		return
+	}
+
+	c.reg.Range(func(_, v interface{}) bool {
+		ipa := v.(*IPAssigner)
+		if ipa.IsAssignedTo(node.Name) {
+			c.logger.Infof("agent on node %s of %s reported, reconciling", node.Name, ipa.fip.Name)
+			ipa.Trigger()
+		}
+		return true
+	})
+}
+
+// handlePodChange will trigger an immediate reconcilation of all ip
+// assigners selecting the pod if the pod was added, deleted, moved to
+// another node or changed its readiness.
+func (c *Service) handlePodChange(oldPod, pod *corev1.Pod) {
+	if oldPod != nil && pod != nil && oldPod.Spec.NodeName == pod.Spec.NodeName && isPodReady(oldPod) == isPodReady(pod) {
+		return
+	}
+
+	if pod == nil {
+		pod = oldPod
+	}
+
+	c.reg.Range(func(_, v interface{}) bool {
+		ipa := v.(*IPAssigner)
+		if ipa.SelectsPod(pod) {
+			c.logger.Infof("pod %s/%s of %s changed, reconciling", pod.Namespace, pod.Name, ipa.fip.Name)
+			ipa.Trigger()
+		}
+		return true
+	})
 }
 
 // EnsureFloatingIP satisfies ServiceSyncer interface.
 func (c *Service) EnsureFloatingIP(fip *hcloudv1alpha1.FloatingIP) error {
+	if fip.DeletionTimestamp != nil {
+		return c.finalizeFloatingIP(fip)
+	}
+
+	if !hasFinalizer(fip) {
+		fipCopy := fip.DeepCopy()
+		fipCopy.Finalizers = append(fipCopy.Finalizers, finalizer)
+		if _, err := c.fipCli.HcloudV1alpha1().FloatingIPs().Update(fipCopy); err != nil {
+			return fmt.Errorf("error adding finalizer to %s: %s", fip.Name, err)
+		}
+	}
+
 	ipav, ok := c.reg.Load(fip.Name)
 	var ipa *IPAssigner
 
@@ -45,7 +253,7 @@ func (c *Service) EnsureFloatingIP(fip *hcloudv1alpha1.FloatingIP) error {
 		// If not the same spec means options have changed, so we don't longer need this ip assigner.
 		if !ipa.SameSpec(fip) {
 			c.logger.Infof("spec of %s changed, recreating ip assigner", ipa.fip.Name)
-			if err := c.DeleteFloatingIP(fip.Name); err != nil {
+			if err := c.stopIPAssigner(fip.Name); err != nil {
 				return err
 			}
 		} else { // We are ok, nothing changed.
@@ -53,16 +261,89 @@ func (c *Service) EnsureFloatingIP(fip *hcloudv1alpha1.FloatingIP) error {
 		}
 	}
 
+	if fip.Spec.PodSelector != nil {
+		if err := c.runPodInformer(); err != nil {
+			return err
+		}
+	}
+
 	// Create an ip assigner.
 	fipCopy := fip.DeepCopy()
-	ipa = NewIPAssigner(fipCopy, c.k8sCli, c.hcloudCli, c.logger)
+	ipa = NewIPAssigner(c.cfg, fipCopy, c.k8sCli, c.fipCli, c.cloudCli, c.nodeInformer.GetStore(), c.podInformer.GetIndexer(), c.recorder, c.metrics, c, c.logger)
 	c.reg.Store(fip.Name, ipa)
 	return ipa.Start()
 	// TODO: garbage collection.
 }
 
-// DeleteFloatingIP satisfies ServiceSyncer interface.
+// NodeLoad satisfies NodeLoader interface.
+func (c *Service) NodeLoad(fip *hcloudv1alpha1.FloatingIP) Load {
+	load := Load{
+		Total: map[string]int{},
+		Peers: map[string]int{},
+	}
+
+	c.reg.Range(func(_, v interface{}) bool {
+		ipa := v.(*IPAssigner)
+		if ipa.fip.Name == fip.Name {
+			return true
+		}
+
+		peer := reflect.DeepEqual(ipa.fip.Spec.NodeSelector, fip.Spec.NodeSelector)
+		for _, node := range ipa.AssignedNodes() {
+			load.Total[node]++
+			if peer {
+				load.Peers[node]++
+			}
+		}
+		return true
+	})
+
+	return load
+}
+
+// DeleteFloatingIP satisfies ServiceSyncer interface. The cleanup in
+// Hetzner already happened while finalizing the resource.
 func (c *Service) DeleteFloatingIP(name string) error {
+	return c.stopIPAssigner(name)
+}
+
+// finalizeFloatingIP will stop the ip assigner of the resource being deleted,
+// apply its deletion policy and remove the finalizer once that succeeded.
+func (c *Service) finalizeFloatingIP(fip *hcloudv1alpha1.FloatingIP) error {
+	if !hasFinalizer(fip) {
+		return c.stopIPAssigner(fip.Name)
+	}
+
+	// Prefer the running ip assigner, its status is the most recent one.
+	var ipa *IPAssigner
+	if ipav, ok := c.reg.Load(fip.Name); ok {
+		ipa = ipav.(*IPAssigner)
+		if err := c.stopIPAssigner(fip.Name); err != nil {
+			return err
+		}
+	} else {
+		ipa = NewIPAssigner(c.cfg, fip.DeepCopy(), c.k8sCli, c.fipCli, c.cloudCli, c.nodeInformer.GetStore(), c.podInformer.GetIndexer(), c.recorder, c.metrics, c, c.logger)
+	}
+
+	if err := ipa.Cleanup(); err != nil {
+		return fmt.Errorf("error cleaning up %s: %s", fip.Name, err)
+	}
+
+	current, err := c.fipCli.HcloudV1alpha1().FloatingIPs().Get(fip.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	current.Finalizers = removeFinalizer(current.Finalizers)
+	if _, err := c.fipCli.HcloudV1alpha1().FloatingIPs().Update(current); err != nil {
+		return fmt.Errorf("error removing finalizer from %s: %s", fip.Name, err)
+	}
+
+	c.logger.Infof("%s finalized", fip.Name)
+	return nil
+}
+
+// stopIPAssigner will stop the ip assigner and remove it from the registry.
+func (c *Service) stopIPAssigner(name string) error {
 	ipav, ok := c.reg.Load(name)
 	if !ok {
 		return nil
@@ -74,5 +355,6 @@ func (c *Service) DeleteFloatingIP(name string) error {
 	}
 
 	c.reg.Delete(name)
+	c.metrics.DeleteFloatingIP(name)
 	return nil
 }
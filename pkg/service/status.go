@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+// Reasons used in the conditions of the floating ip status and in events.
+const (
+	reasonAssigned             = "Assigned"
+	reasonReassigned           = "Reassigned"
+	reasonReconciled           = "Reconciled"
+	reasonReconcileFailed      = "ReconcileFailed"
+	reasonNoEligibleNodes      = "NoEligibleNodes"
+	reasonHCloudAPIError       = "HCloudAPIError"
+	reasonInvalidSpec          = "InvalidSpec"
+	reasonFloatingIPNotFound   = "FloatingIPNotFound"
+	reasonAmbiguousReference   = "AmbiguousReference"
+	reasonActionFailed         = "ActionFailed"
+	reasonActionTimeout        = "ActionTimeout"
+	reasonActionRunning        = "ActionRunning"
+	reasonAwaitingAgent        = "AwaitingAgent"
+	reasonReassignmentDeferred = "ReassignmentDeferred"
+	reasonReassignmentPaused   = "ReassignmentPaused"
+	reasonServerNotFound       = "ServerNotFound"
+	reasonHealthCheckSucceeded = "HealthCheckSucceeded"
+	reasonHealthCheckFailed    = "HealthCheckFailed"
+	reasonFloatingIPAssigned   = "FloatingIPAssigned"
+	reasonFloatingIPUnassigned = "FloatingIPUnassigned"
+)
+
+// reconcileError is an error that occurred during reconcilation together
+// with the reason why it occurred.
+type reconcileError struct {
+	reason string
+	err    error
+}
+
+func newReconcileError(reason string, err error) error {
+	return &reconcileError{reason: reason, err: err}
+}
+
+func (e *reconcileError) Error() string { return e.err.Error() }
+
+// errorReason returns the reason of a reconcile error.
+func errorReason(err error) string {
+	if rerr, ok := err.(*reconcileError); ok {
+		return rerr.reason
+	}
+	return reasonReconcileFailed
+}
+
+// assignedMessage returns the message of the assigned condition.
+func assignedMessage(status *hcloudv1alpha1.FloatingIPStatus) string {
+	if len(status.IPs) == 0 {
+		return fmt.Sprintf("assigned to node %s", status.NodeName)
+	}
+
+	nodes := []string{}
+	seen := map[string]bool{}
+	for _, a := range status.IPs {
+		if !seen[a.NodeName] {
+			seen[a.NodeName] = true
+			nodes = append(nodes, a.NodeName)
+		}
+	}
+	return fmt.Sprintf("assigned %d floating ips to nodes %s", len(status.IPs), strings.Join(nodes, ", "))
+}
+
+// assignedNodes returns the node of every address of the status, the
+// floating ips of a pool each have their own node.
+func assignedNodes(status *hcloudv1alpha1.FloatingIPStatus) map[string]string {
+	nodes := map[string]string{}
+	if len(status.IPs) == 0 {
+		nodes[status.IP] = status.NodeName
+		return nodes
+	}
+	for _, a := range status.IPs {
+		nodes[a.IP] = a.NodeName
+	}
+	return nodes
+}
+
+// setCondition will add or update the condition of the given type. The
+// transition time is only changed if the status of the condition changed.
+func setCondition(status *hcloudv1alpha1.FloatingIPStatus, condType hcloudv1alpha1.FloatingIPConditionType, condStatus corev1.ConditionStatus, reason, message string, now metav1.Time) {
+	for i := range status.Conditions {
+		cond := &status.Conditions[i]
+		if cond.Type != condType {
+			continue
+		}
+
+		if cond.Status != condStatus {
+			cond.LastTransitionTime = now
+		}
+		cond.Status = condStatus
+		cond.Reason = reason
+		cond.Message = message
+		return
+	}
+
+	status.Conditions = append(status.Conditions, hcloudv1alpha1.FloatingIPCondition{
+		Type:               condType,
+		Status:             condStatus,
+		LastTransitionTime: now,
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+// Load is the number of floating ips the operator has assigned to each node.
+type Load struct {
+	// Total is the number of all floating ips by node name.
+	Total map[string]int
+	// Peers is the number of floating ips with the same node selector by
+	// node name.
+	Peers map[string]int
+}
+
+// NodeLoader knows the load of the nodes from the point of view of a
+// floating ip. The floating ip itself is not included in the load.
+type NodeLoader interface {
+	NodeLoad(fip *hcloudv1alpha1.FloatingIP) Load
+}
+
+// Strategy selects the node a floating ip is assigned to.
+type Strategy interface {
+	// Select returns the target out of the probable nodes, nodes is never
+	// empty.
+	Select(fip *hcloudv1alpha1.FloatingIP, nodes []corev1.Node, load Load) corev1.Node
+}
+
+// strategies are the available strategies by name.
+var strategies = map[hcloudv1alpha1.SelectionStrategy]Strategy{
+	hcloudv1alpha1.StrategyRandom:             &randomStrategy{},
+	hcloudv1alpha1.StrategyFirstByName:        &firstByNameStrategy{},
+	hcloudv1alpha1.StrategyLeastLoaded:        &leastLoadedStrategy{},
+	hcloudv1alpha1.StrategySpread:             &spreadStrategy{},
+	hcloudv1alpha1.StrategyPreferredNodeOrder: &preferredNodeOrderStrategy{},
+}
+
+// getStrategy returns the strategy of the spec. Without a strategy the
+// preferred-node-order strategy is used if preferred nodes are set and the
+// random strategy otherwise.
+func getStrategy(spec *hcloudv1alpha1.FloatinIPSpec) (Strategy, error) {
+	name := spec.Strategy
+	if name == "" && len(spec.PreferredNodes) > 0 {
+		name = hcloudv1alpha1.StrategyPreferredNodeOrder
+	}
+	if name == "" {
+		name = hcloudv1alpha1.StrategyRandom
+	}
+
+	strategy, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %s", name)
+	}
+	return strategy, nil
+}
+
+// randomStrategy will select one node randomly.
+type randomStrategy struct{}
+
+func (s *randomStrategy) Select(_ *hcloudv1alpha1.FloatingIP, nodes []corev1.Node, _ Load) corev1.Node {
+	return nodes[rand.Intn(len(nodes))]
+}
+
+// firstByNameStrategy will select the first node ordered by name.
+type firstByNameStrategy struct{}
+
+func (s *firstByNameStrategy) Select(_ *hcloudv1alpha1.FloatingIP, nodes []corev1.Node, _ Load) corev1.Node {
+	return sortedByName(nodes)[0]
+}
+
+// leastLoadedStrategy will select the node with the fewest floating ips.
+type leastLoadedStrategy struct{}
+
+func (s *leastLoadedStrategy) Select(_ *hcloudv1alpha1.FloatingIP, nodes []corev1.Node, load Load) corev1.Node {
+	return minByCount(nodes, load.Total)
+}
+
+// spreadStrategy will select the node with the fewest floating ips with the
+// same node selector, so these floating ips end up on different nodes.
+type spreadStrategy struct{}
+
+func (s *spreadStrategy) Select(_ *hcloudv1alpha1.FloatingIP, nodes []corev1.Node, load Load) corev1.Node {
+	return minByCount(nodes, load.Peers)
+}
+
+// preferredNodeOrderStrategy will select the most preferred node of the
+// preferred nodes that is a probable node. If none of them is available the
+// first node by name is selected.
+type preferredNodeOrderStrategy struct{}
+
+func (s *preferredNodeOrderStrategy) Select(fip *hcloudv1alpha1.FloatingIP, nodes []corev1.Node, _ Load) corev1.Node {
+	if node := mostPreferred(fip, nodes); node != nil {
+		return *node
+	}
+	return sortedByName(nodes)[0]
+}
+
+// preferredOrder returns the names of the preferred nodes ordered by
+// descending weight, nodes with the same weight keep the order of the spec.
+func preferredOrder(fip *hcloudv1alpha1.FloatingIP) []string {
+	preferred := make([]hcloudv1alpha1.PreferredNode, len(fip.Spec.PreferredNodes))
+	copy(preferred, fip.Spec.PreferredNodes)
+	sort.SliceStable(preferred, func(i, j int) bool { return preferred[i].Weight > preferred[j].Weight })
+
+	names := make([]string, len(preferred))
+	for i, node := range preferred {
+		names[i] = node.Name
+	}
+	return names
+}
+
+// preferenceRank returns the position of the node in the preferred order,
+// nodes that are not preferred rank after all preferred nodes.
+func preferenceRank(order []string, name string) int {
+	for i, n := range order {
+		if n == name {
+			return i
+		}
+	}
+	return len(order)
+}
+
+// mostPreferred returns the most preferred of the nodes, nil if none of
+// them is preferred.
+func mostPreferred(fip *hcloudv1alpha1.FloatingIP, nodes []corev1.Node) *corev1.Node {
+	order := preferredOrder(fip)
+	var best *corev1.Node
+	for i := range nodes {
+		rank := preferenceRank(order, nodes[i].Name)
+		if rank < len(order) && (best == nil || rank < preferenceRank(order, best.Name)) {
+			best = &nodes[i]
+		}
+	}
+	return best
+}
+
+// sortedByName returns a copy of the nodes ordered by name.
+func sortedByName(nodes []corev1.Node) []corev1.Node {
+	sorted := make([]corev1.Node, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// minByCount returns the node with the lowest count, ties are broken by
+// node name.
+func minByCount(nodes []corev1.Node, counts map[string]int) corev1.Node {
+	sorted := sortedByName(nodes)
+	target := sorted[0]
+	for _, node := range sorted[1:] {
+		if counts[node.Name] < counts[target.Name] {
+			target = node
+		}
+	}
+	return target
+}
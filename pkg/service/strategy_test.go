@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
+)
+
+func TestGetStrategy(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        hcloudv1alpha1.FloatinIPSpec
+		expStrategy Strategy
+		expErr      bool
+	}{
+		{
+			name:        "Random strategy is the default",
+			expStrategy: &randomStrategy{},
+		},
+		{
+			name:        "Preferred node order strategy is the default with preferred nodes",
+			spec:        hcloudv1alpha1.FloatinIPSpec{PreferredNodes: []hcloudv1alpha1.PreferredNode{{Name: "node1"}}},
+			expStrategy: &preferredNodeOrderStrategy{},
+		},
+		{
+			name: "Strategy of the spec takes precedence over preferred nodes",
+			spec: hcloudv1alpha1.FloatinIPSpec{
+				Strategy:       hcloudv1alpha1.StrategyLeastLoaded,
+				PreferredNodes: []hcloudv1alpha1.PreferredNode{{Name: "node1"}},
+			},
+			expStrategy: &leastLoadedStrategy{},
+		},
+		{
+			name:        "Strategy of the spec is used",
+			spec:        hcloudv1alpha1.FloatinIPSpec{Strategy: hcloudv1alpha1.StrategySpread},
+			expStrategy: &spreadStrategy{},
+		},
+		{
+			name:   "Unknown strategy is an error",
+			spec:   hcloudv1alpha1.FloatinIPSpec{Strategy: "unknown"},
+			expErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := getStrategy(&test.spec)
+
+			if test.expErr {
+				if err == nil {
+					t.Errorf("expected an error, got %T", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if fmt.Sprintf("%T", got) != fmt.Sprintf("%T", test.expStrategy) {
+				t.Errorf("expected strategy %T, got %T", test.expStrategy, got)
+			}
+		})
+	}
+}
+
+func TestStrategySelect(t *testing.T) {
+	nodes := func(names ...string) []corev1.Node {
+		var nodes []corev1.Node
+		for _, name := range names {
+			nodes = append(nodes, corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		}
+		return nodes
+	}
+
+	tests := []struct {
+		name      string
+		strategy  hcloudv1alpha1.SelectionStrategy
+		preferred []hcloudv1alpha1.PreferredNode
+		nodes     []corev1.Node
+		load      Load
+		expNode   string
+	}{
+		{
+			name:     "First by name selects the first node ordered by name",
+			strategy: hcloudv1alpha1.StrategyFirstByName,
+			nodes:    nodes("node3", "node1", "node2"),
+			expNode:  "node1",
+		},
+		{
+			name:     "Least loaded selects the node with the fewest floating ips",
+			strategy: hcloudv1alpha1.StrategyLeastLoaded,
+			nodes:    nodes("node1", "node2", "node3"),
+			load:     Load{Total: map[string]int{"node1": 2, "node2": 1, "node3": 3}, Peers: map[string]int{"node2": 1}},
+			expNode:  "node2",
+		},
+		{
+			name:     "Least loaded breaks ties by name",
+			strategy: hcloudv1alpha1.StrategyLeastLoaded,
+			nodes:    nodes("node3", "node2", "node1"),
+			load:     Load{Total: map[string]int{"node1": 1}},
+			expNode:  "node2",
+		},
+		{
+			name:     "Spread selects the node with the fewest peers",
+			strategy: hcloudv1alpha1.StrategySpread,
+			nodes:    nodes("node1", "node2", "node3"),
+			load:     Load{Total: map[string]int{"node3": 5}, Peers: map[string]int{"node1": 1, "node2": 1}},
+			expNode:  "node3",
+		},
+		{
+			name:      "Preferred node order selects the node with the highest weight",
+			strategy:  hcloudv1alpha1.StrategyPreferredNodeOrder,
+			preferred: []hcloudv1alpha1.PreferredNode{{Name: "node1"}, {Name: "node3", Weight: 10}},
+			nodes:     nodes("node1", "node2", "node3"),
+			expNode:   "node3",
+		},
+		{
+			name:      "Preferred node order keeps the order of nodes with the same weight",
+			strategy:  hcloudv1alpha1.StrategyPreferredNodeOrder,
+			preferred: []hcloudv1alpha1.PreferredNode{{Name: "node2"}, {Name: "node1"}},
+			nodes:     nodes("node1", "node2"),
+			expNode:   "node2",
+		},
+		{
+			name:      "Preferred node order skips preferred nodes that are no probable nodes",
+			strategy:  hcloudv1alpha1.StrategyPreferredNodeOrder,
+			preferred: []hcloudv1alpha1.PreferredNode{{Name: "node4", Weight: 10}, {Name: "node2"}},
+			nodes:     nodes("node1", "node2", "node3"),
+			expNode:   "node2",
+		},
+		{
+			name:      "Preferred node order falls back to the first node by name",
+			strategy:  hcloudv1alpha1.StrategyPreferredNodeOrder,
+			preferred: []hcloudv1alpha1.PreferredNode{{Name: "node4"}},
+			nodes:     nodes("node3", "node2"),
+			expNode:   "node2",
+		},
+		{
+			name:     "Random selects the only node",
+			strategy: hcloudv1alpha1.StrategyRandom,
+			nodes:    nodes("node1"),
+			expNode:  "node1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fip := &hcloudv1alpha1.FloatingIP{
+				ObjectMeta: metav1.ObjectMeta{Name: "test"},
+				Spec:       hcloudv1alpha1.FloatinIPSpec{Strategy: test.strategy, PreferredNodes: test.preferred},
+			}
+			strategy, err := getStrategy(&fip.Spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strategy.Select(fip, test.nodes, test.load); got.Name != test.expNode {
+				t.Errorf("expected node %s, got %s", test.expNode, got.Name)
+			}
+		})
+	}
+}
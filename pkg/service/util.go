@@ -1,6 +1,9 @@
 package service
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
 	hcloudv1alpha1 "github.com/apricote/hcloud-floating-ip-operator/apis/hcloud/v1alpha1"
 )
 
@@ -10,3 +13,33 @@ func max(x, y hcloudv1alpha1.Seconds) hcloudv1alpha1.Seconds {
 	}
 	return y
 }
+
+// isNodeReady checks if the node reports the Ready condition.
+func isNodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// isPodReady checks if the pod reports the Ready condition.
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nodeReference returns a reference to the node that can be used to record
+// events, the same way the kubelet references its node.
+func nodeReference(name string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind: "Node",
+		Name: name,
+		UID:  types.UID(name),
+	}
+}